@@ -0,0 +1,66 @@
+package request
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+)
+
+type backendKey struct{}
+
+// backend records where a request ended up. HTTPBalancer overwrites host
+// with the host it picked, and every connection the request gets overwrites
+// ip, so after retries both describe the last attempt.
+type backend struct {
+	mu   sync.Mutex
+	host string
+	ip   string
+}
+
+func (b *backend) set(host, ip string) {
+	b.mu.Lock()
+	if host != "" {
+		b.host = host
+	}
+	if ip != "" {
+		b.ip = ip
+	}
+	b.mu.Unlock()
+}
+
+func withBackend(req *http.Request) *http.Request {
+	b := &backend{host: req.URL.Host}
+	ctx := context.WithValue(req.Context(), backendKey{}, b)
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String()); err == nil {
+				b.set("", host)
+			}
+		},
+	})
+	return req.WithContext(ctx)
+}
+
+func backendFrom(ctx context.Context) *backend {
+	b, _ := ctx.Value(backendKey{}).(*backend)
+	return b
+}
+
+// Backend reports which backend served the response: host is the base URL
+// host or the host HTTPBalancer picked, and ip the remote address of the
+// connection (a proxy's address when one is used). ip is empty when no
+// connection was involved, e.g. for a response served from the cache.
+func (r *Resp) Backend() (host, ip string) {
+	if r.Request == nil {
+		return "", ""
+	}
+	b := backendFrom(r.Request.Context())
+	if b == nil {
+		return r.Request.URL.Host, ""
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.host, b.ip
+}
@@ -0,0 +1,170 @@
+package request
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Builder is a typed alternative to the variadic params of Do. Its setters
+// record the request and the send methods turn it into params for Do, so a
+// Builder can be sent many times, and Clone derives templated requests from
+// it. A Builder is not safe for concurrent modification.
+type Builder struct {
+	client      *Client
+	header      http.Header
+	query       Query
+	queryAppend url.Values
+	pathParams  PathParams
+	body        any
+	params      []any
+}
+
+// R starts a Builder for a request sent through r.
+func (r *Client) R() *Builder {
+	return &Builder{client: r}
+}
+
+// Clone returns a copy of b that can be changed without affecting b.
+func (b *Builder) Clone() *Builder {
+	clone := *b
+	clone.header = b.header.Clone()
+	if b.query != nil {
+		clone.query = make(Query, len(b.query))
+		for key, value := range b.query {
+			clone.query[key] = value
+		}
+	}
+	if b.queryAppend != nil {
+		clone.queryAppend = make(url.Values, len(b.queryAppend))
+		for key, values := range b.queryAppend {
+			clone.queryAppend[key] = append([]string(nil), values...)
+		}
+	}
+	if b.pathParams != nil {
+		clone.pathParams = make(PathParams, len(b.pathParams))
+		for key, value := range b.pathParams {
+			clone.pathParams[key] = value
+		}
+	}
+	clone.params = append([]any(nil), b.params...)
+	return &clone
+}
+
+func (b *Builder) SetHeader(key, value string) *Builder {
+	if b.header == nil {
+		b.header = make(http.Header)
+	}
+	b.header.Set(key, value)
+	return b
+}
+
+func (b *Builder) AddHeader(key, value string) *Builder {
+	if b.header == nil {
+		b.header = make(http.Header)
+	}
+	b.header.Add(key, value)
+	return b
+}
+
+func (b *Builder) SetHeaders(headers Headers) *Builder {
+	for key, value := range headers {
+		b.SetHeader(key, value)
+	}
+	return b
+}
+
+// SetQuery sets a query parameter with the semantics of a Query param.
+func (b *Builder) SetQuery(key, value string) *Builder {
+	if b.query == nil {
+		b.query = make(Query)
+	}
+	b.query[key] = value
+	return b
+}
+
+// AddQuery adds a query parameter with the semantics of a QueryAppend param.
+func (b *Builder) AddQuery(key, value string) *Builder {
+	if b.queryAppend == nil {
+		b.queryAppend = make(url.Values)
+	}
+	b.queryAppend.Add(key, value)
+	return b
+}
+
+func (b *Builder) SetPathParam(key, value string) *Builder {
+	if b.pathParams == nil {
+		b.pathParams = make(PathParams)
+	}
+	b.pathParams[key] = value
+	return b
+}
+
+// SetBody sets the body to any body param Do accepts, replacing the previous
+// one. Readers can only be sent once.
+func (b *Builder) SetBody(body any) *Builder {
+	b.body = body
+	return b
+}
+
+func (b *Builder) SetJSONBody(v any) *Builder {
+	return b.SetBody(BodyJSON(v))
+}
+
+func (b *Builder) SetFormData(form MapForm) *Builder {
+	return b.SetBody(form)
+}
+
+// SetParams adds params that have no setter, e.g. a Retry or Host, to be
+// passed to Do as is.
+func (b *Builder) SetParams(params ...any) *Builder {
+	b.params = append(b.params, params...)
+	return b
+}
+
+func (b *Builder) Do(ctx context.Context, method, uri string) (*Resp, error) {
+	return b.client.Do(ctx, method, uri, b.buildParams()...)
+}
+
+func (b *Builder) Get(ctx context.Context, uri string) (*Resp, error) {
+	return b.Do(ctx, http.MethodGet, uri)
+}
+
+func (b *Builder) Post(ctx context.Context, uri string) (*Resp, error) {
+	return b.Do(ctx, http.MethodPost, uri)
+}
+
+func (b *Builder) Patch(ctx context.Context, uri string) (*Resp, error) {
+	return b.Do(ctx, http.MethodPatch, uri)
+}
+
+func (b *Builder) Put(ctx context.Context, uri string) (*Resp, error) {
+	return b.Do(ctx, http.MethodPut, uri)
+}
+
+func (b *Builder) Delete(ctx context.Context, uri string) (*Resp, error) {
+	return b.Do(ctx, http.MethodDelete, uri)
+}
+
+func (b *Builder) buildParams() []any {
+	params := make([]any, 0, len(b.params)+5)
+	// Do sets a default Content-Type on the header param, so send a copy to
+	// keep b reusable.
+	if b.header != nil {
+		params = append(params, b.header.Clone())
+	}
+	if b.query != nil {
+		params = append(params, b.query)
+	}
+	if b.queryAppend != nil {
+		params = append(params, QueryAppend(b.queryAppend))
+	}
+	if b.pathParams != nil {
+		params = append(params, b.pathParams)
+	}
+	params = append(params, b.params...)
+	if b.body != nil {
+		params = append(params, b.body)
+	}
+	return params
+}
@@ -0,0 +1,256 @@
+package request
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type CacheEntry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Expires    time.Time
+	// VaryHeader holds the request headers named by the response's Vary
+	// header. The entry is only used for requests with the same values.
+	VaryHeader http.Header
+}
+
+// Cache stores GET/HEAD responses keyed by method and URL. Implementations
+// must be safe for concurrent use.
+type Cache interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, entry *CacheEntry)
+	Delete(key string)
+}
+
+type MemoryCache struct {
+	mu      sync.RWMutex
+	entries map[string]*CacheEntry
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]*CacheEntry)}
+}
+
+func (c *MemoryCache) Get(key string) (*CacheEntry, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	return entry, ok
+}
+
+func (c *MemoryCache) Set(key string, entry *CacheEntry) {
+	c.mu.Lock()
+	c.entries[key] = entry
+	c.mu.Unlock()
+}
+
+func (c *MemoryCache) Delete(key string) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
+func (r *Client) EnableCache(cache Cache) *Client {
+	r.cache = cache
+	return r
+}
+
+// uncacheableRequestHeaders make the response depend on state the cache key
+// doesn't capture, so such requests bypass the cache.
+var uncacheableRequestHeaders = []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since"}
+
+func isCacheableRequest(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead || isUpgradeRequest(req) {
+		return false
+	}
+	for _, key := range uncacheableRequestHeaders {
+		if req.Header.Get(key) != "" {
+			return false
+		}
+	}
+	_, noStore := parseCacheControl(req.Header)["no-store"]
+	return !noStore
+}
+
+// cacheKey tells apart requests sent with different credentials, so one
+// caller never gets a response meant for another.
+func cacheKey(req *http.Request) string {
+	key := req.Method + " " + req.URL.String()
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		key += " " + hex.EncodeToString(sum[:])
+	}
+	return key
+}
+
+func (r *Client) sendCached(req *http.Request) (*http.Response, error) {
+	key := cacheKey(req)
+
+	entry, ok := r.cache.Get(key)
+	if ok && !entry.matches(req) {
+		entry, ok = nil, false
+	}
+	send := req
+	if ok {
+		if time.Now().Before(entry.Expires) {
+			return entry.response(req), nil
+		}
+		// The validators go on a copy: a retry sends req again, and must
+		// still be recognised as a cacheable request rather than a
+		// conditional one the caller made.
+		send = req.Clone(req.Context())
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			send.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+			send.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	resp, err := r.http.Do(send)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && ok {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		header := entry.Header.Clone()
+		for key, values := range resp.Header {
+			header[key] = values
+		}
+		entry = &CacheEntry{
+			StatusCode: entry.StatusCode,
+			Header:     header,
+			Body:       entry.Body,
+			Expires:    cacheExpires(resp.Header),
+			VaryHeader: entry.VaryHeader,
+		}
+		r.cache.Set(key, entry)
+		return entry.response(req), nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || resp.StatusCode == http.StatusPartialContent {
+		return resp, nil
+	}
+	varyHeader, ok := varyHeader(req, resp.Header)
+	if !ok {
+		return resp, nil
+	}
+	if _, noStore := parseCacheControl(resp.Header)["no-store"]; noStore {
+		r.cache.Delete(key)
+		return resp, nil
+	}
+
+	expires := cacheExpires(resp.Header)
+	if resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "" && !time.Now().Before(expires) {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	r.cache.Set(key, &CacheEntry{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+		Expires:    expires,
+		VaryHeader: varyHeader,
+	})
+	return resp, nil
+}
+
+// varyHeader collects the request headers the response varies on. ok is
+// false for "Vary: *", which can't be matched.
+func varyHeader(req *http.Request, header http.Header) (http.Header, bool) {
+	var vary http.Header
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+			if name == "" {
+				continue
+			}
+			if vary == nil {
+				vary = make(http.Header)
+			}
+			vary[http.CanonicalHeaderKey(name)] = req.Header.Values(name)
+		}
+	}
+	return vary, true
+}
+
+func (e *CacheEntry) matches(req *http.Request) bool {
+	for name, values := range e.VaryHeader {
+		if strings.Join(req.Header.Values(name), ",") != strings.Join(values, ",") {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *CacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+func cacheExpires(header http.Header) time.Time {
+	now := time.Now()
+	directives := parseCacheControl(header)
+	if _, ok := directives["no-cache"]; ok {
+		return now
+	}
+	if maxAge, ok := directives["max-age"]; ok {
+		seconds, err := strconv.Atoi(maxAge)
+		if err != nil || seconds <= 0 {
+			return now
+		}
+		return now.Add(time.Duration(seconds) * time.Second)
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		if t, err := http.ParseTime(expires); err == nil {
+			return t
+		}
+	}
+	return now
+}
+
+func parseCacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range header.Values("Cache-Control") {
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, arg, _ := strings.Cut(part, "=")
+			directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+		}
+	}
+	return directives
+}
@@ -0,0 +1,125 @@
+package request
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheSkipsRangeAndVary(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept")
+		if r.URL.Path == "/range" {
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(body))
+			return
+		}
+		_, _ = w.Write([]byte(r.Header.Get("Accept") + "|" + r.Header.Get("Authorization")))
+	}))
+	defer srv.Close()
+
+	client := New().SetBaseURL(srv.URL).EnableCache(NewMemoryCache())
+	get := func(uri string, params ...any) (int, string) {
+		t.Helper()
+		resp, err := client.Get(context.Background(), uri, params...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := resp.ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(data)
+	}
+
+	if status, _ := get("/range", Headers{"Range": "bytes=90-"}); status != http.StatusPartialContent {
+		t.Fatalf("got status %d, want 206", status)
+	}
+	if status, data := get("/range"); status != http.StatusOK || len(data) != len(body) {
+		t.Fatalf("got status %d with %d bytes, want the full body", status, len(data))
+	}
+
+	if _, data := get("/vary", Headers{"Accept": "a", "Authorization": "one"}); data != "a|one" {
+		t.Fatalf("got %q", data)
+	}
+	if _, data := get("/vary", Headers{"Accept": "b", "Authorization": "one"}); data != "b|one" {
+		t.Fatalf("got %q, want a response for Accept b", data)
+	}
+	if _, data := get("/vary", Headers{"Accept": "b", "Authorization": "two"}); data != "b|two" {
+		t.Fatalf("got %q, want a response for the second credentials", data)
+	}
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	var failNext bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.URL.Path+" "+r.Header.Get("If-None-Match"))
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		default:
+			if failNext {
+				failNext = false
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		_, _ = w.Write([]byte("body of " + r.URL.Path))
+	}))
+	defer srv.Close()
+
+	client := New().SetBaseURL(srv.URL).EnableCache(NewMemoryCache()).SetRetry(2, nil)
+	get := func(uri string) {
+		t.Helper()
+		resp, err := client.Get(context.Background(), uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := resp.ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || string(data) != "body of "+uri {
+			t.Fatalf("%s: got status %d with body %q", uri, resp.StatusCode, data)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		get("/fresh")
+		get("/no-store")
+		get("/etag")
+	}
+	mu.Lock()
+	failNext = true
+	mu.Unlock()
+	get("/etag")
+
+	want := []string{
+		"/fresh ",
+		"/no-store ",
+		"/etag ",
+		"/no-store ",
+		`/etag "v1"`,
+		`/etag "v1"`,
+		`/etag "v1"`,
+	}
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("server got\n%s\nwant\n%s", strings.Join(requests, "\n"), strings.Join(want, "\n"))
+	}
+}
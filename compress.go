@@ -0,0 +1,327 @@
+package request
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// EnableZstd advertises gzip and zstd support and decodes the response body
+// according to its Content-Encoding. Go's transparent gzip handling is turned
+// off so both encodings go through the same path.
+func (r *Client) EnableZstd() *Client {
+	r.zstd = true
+	if transport := r.transport(); transport != nil {
+		transport.DisableCompression = true
+	}
+	return r
+}
+
+var defaultCompressibleTypes = []string{
+	"text/*",
+	"application/json",
+	"application/xml",
+	"application/javascript",
+	"application/x-www-form-urlencoded",
+	"+json",
+	"+xml",
+}
+
+type requestCompression struct {
+	minSize int64
+	types   []string
+}
+
+// EnableRequestCompression gzips request bodies of at least minSize bytes,
+// or of unknown length, whose Content-Type is compressible: text, JSON, XML
+// and forms by default, see SetCompressibleTypes. Requests that set a
+// Content-Encoding already are sent as is. Retries and redirects compress
+// the original body again through GetBody rather than replaying a partly
+// consumed gzip stream.
+func (r *Client) EnableRequestCompression(minSize int64) *Client {
+	types := defaultCompressibleTypes
+	if r.compressReq != nil {
+		types = r.compressReq.types
+	}
+	r.compressReq = &requestCompression{minSize: minSize, types: types}
+	return r
+}
+
+// SetCompressibleTypes replaces the media types EnableRequestCompression
+// compresses. An entry like "text/*" matches a whole top-level type, and one
+// like "+json" matches a structured syntax suffix.
+func (r *Client) SetCompressibleTypes(types ...string) *Client {
+	types = append([]string(nil), types...)
+	if r.compressReq == nil {
+		r.compressReq = &requestCompression{types: types}
+		return r
+	}
+	r.compressReq = &requestCompression{minSize: r.compressReq.minSize, types: types}
+	return r
+}
+
+func (c *requestCompression) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.types {
+		t = strings.ToLower(t)
+		switch {
+		case strings.HasPrefix(t, "+"):
+			if strings.HasSuffix(mediaType, t) {
+				return true
+			}
+		case strings.HasSuffix(t, "/*"):
+			if strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*")) {
+				return true
+			}
+		case mediaType == t:
+			return true
+		}
+	}
+	return false
+}
+
+func (c *requestCompression) apply(req *http.Request) {
+	if req.Header.Get("Content-Encoding") != "" || !c.compressible(req.Header.Get("Content-Type")) {
+		return
+	}
+	if req.ContentLength > 0 && req.ContentLength < c.minSize {
+		return
+	}
+
+	req.Body = newGzipBody(req.Body)
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return newGzipBody(body), nil
+		}
+	}
+	req.ContentLength = -1
+	req.Header.Del("Content-Length")
+	req.Header.Set("Content-Encoding", "gzip")
+}
+
+// gzipBody compresses body like newGzipReader and closes body along with
+// itself. Compression starts on the first Read, so a request that is built
+// but never sent leaves no goroutine behind.
+type gzipBody struct {
+	body   io.ReadCloser
+	mu     sync.Mutex
+	gz     io.ReadCloser
+	closed bool
+}
+
+func newGzipBody(body io.ReadCloser) io.ReadCloser {
+	return &gzipBody{body: body}
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return 0, http.ErrBodyReadAfterClose
+	}
+	if b.gz == nil {
+		b.gz = newGzipReader(b.body)
+	}
+	gz := b.gz
+	b.mu.Unlock()
+	return gz.Read(p)
+}
+
+// Close may be called by the transport while a Read is in progress.
+func (b *gzipBody) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	gz := b.gz
+	b.mu.Unlock()
+	if gz != nil {
+		_ = gz.Close()
+	}
+	return b.body.Close()
+}
+
+// gzipWriterPool and gzipReaderPool recycle gzip state, which is large
+// compared to typical request and response bodies.
+var (
+	gzipWriterPool sync.Pool
+	gzipReaderPool sync.Pool
+)
+
+// newGzipReader returns a reader that yields the gzip-compressed form of src.
+// Compression runs in a goroutine that stops once the reader is drained or
+// closed.
+func newGzipReader(src io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		writer, ok := gzipWriterPool.Get().(*gzip.Writer)
+		if ok {
+			writer.Reset(pw)
+		} else {
+			writer = gzip.NewWriter(pw)
+		}
+		_, err := io.Copy(writer, src)
+		if closeErr := writer.Close(); err == nil {
+			err = closeErr
+		}
+		gzipWriterPool.Put(writer)
+		_ = pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// gzipBytes compresses data in memory, for bodies that are already buffered.
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, ok := gzipWriterPool.Get().(*gzip.Writer)
+	if ok {
+		writer.Reset(&buf)
+	} else {
+		writer = gzip.NewWriter(&buf)
+	}
+	defer gzipWriterPool.Put(writer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type newDecoderFunc func(io.Reader) (io.Reader, func(), error)
+
+func newGzipDecoder(src io.Reader) (io.Reader, func(), error) {
+	reader, ok := gzipReaderPool.Get().(*gzip.Reader)
+	var err error
+	if ok {
+		err = reader.Reset(src)
+	} else {
+		reader, err = gzip.NewReader(src)
+	}
+	if err != nil {
+		if reader != nil {
+			gzipReaderPool.Put(reader)
+		}
+		return nil, nil, err
+	}
+	// Some servers flush the body as several gzip members; read them all
+	// rather than stopping at the first member boundary.
+	reader.Multistream(true)
+	return reader, func() {
+		_ = reader.Close()
+		gzipReaderPool.Put(reader)
+	}, nil
+}
+
+func newZstdDecoder(src io.Reader) (io.Reader, func(), error) {
+	decoder, err := zstd.NewReader(src, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, nil, err
+	}
+	return decoder, decoder.Close, nil
+}
+
+// decompressResponse decodes the Content-Encoding of resp, which may list
+// several codings to undo in reverse order. "identity" and empty entries are
+// skipped. A coding it doesn't know leaves the body as received, with a
+// warning through logger.
+func decompressResponse(resp *http.Response, logger Logger) {
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return
+	}
+
+	var decoders []newDecoderFunc
+	for _, values := range resp.Header.Values("Content-Encoding") {
+		for _, coding := range strings.Split(values, ",") {
+			switch strings.ToLower(strings.TrimSpace(coding)) {
+			case "", "identity":
+			case "gzip", "x-gzip":
+				decoders = append(decoders, newGzipDecoder)
+			case "zstd":
+				decoders = append(decoders, newZstdDecoder)
+			default:
+				logger.Warnf("request: leaving body with unsupported Content-Encoding %q undecoded", strings.TrimSpace(coding))
+				return
+			}
+		}
+	}
+	if len(decoders) == 0 {
+		resp.Header.Del("Content-Encoding")
+		return
+	}
+
+	resp.Body = &decompressBody{body: resp.Body, newDecoder: chainDecoders(decoders)}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
+
+// chainDecoders undoes the codings in decoders, last applied first.
+func chainDecoders(decoders []newDecoderFunc) newDecoderFunc {
+	if len(decoders) == 1 {
+		return decoders[0]
+	}
+	return func(src io.Reader) (io.Reader, func(), error) {
+		var releases []func()
+		release := func() {
+			for i := len(releases) - 1; i >= 0; i-- {
+				releases[i]()
+			}
+		}
+		reader := src
+		for i := len(decoders) - 1; i >= 0; i-- {
+			next, nextRelease, err := decoders[i](reader)
+			if err != nil {
+				release()
+				return nil, nil, err
+			}
+			reader = next
+			releases = append(releases, nextRelease)
+		}
+		return reader, release, nil
+	}
+}
+
+// decompressBody creates the decoder lazily on the first Read, so Do does
+// not block on reading the compression header, and releases it on Close.
+type decompressBody struct {
+	body       io.ReadCloser
+	newDecoder newDecoderFunc
+	reader     io.Reader
+	release    func()
+	err        error
+}
+
+func (b *decompressBody) Read(p []byte) (int, error) {
+	if b.reader == nil && b.err == nil {
+		b.reader, b.release, b.err = b.newDecoder(b.body)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.reader.Read(p)
+}
+
+func (b *decompressBody) Close() error {
+	if b.release != nil {
+		b.release()
+		b.release = nil
+	}
+	// The decoder may be back in a pool, so it must not be read again.
+	b.reader = nil
+	b.err = http.ErrBodyReadAfterClose
+	return b.body.Close()
+}
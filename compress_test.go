@@ -0,0 +1,258 @@
+package request
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestCompressionRedirect(t *testing.T) {
+	payload := strings.Repeat(`{"key":"value"}`, 100)
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			http.Error(w, "body is not gzipped", http.StatusBadRequest)
+			return
+		}
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusTemporaryRedirect)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	client := New().SetBaseURL(srv.URL).EnableRequestCompression(0)
+	resp, err := client.Post(context.Background(), "/old", Headers{"Content-Type": "application/json"}, strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := resp.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(data) != payload {
+		t.Fatalf("got status %d with body %.40q, want the original payload", resp.StatusCode, data)
+	}
+	if len(paths) != 2 || paths[1] != "/new" {
+		t.Fatalf("got requests to %v, want /old then /new", paths)
+	}
+}
+
+func TestRequestCompressionBeforeSigner(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(body)
+		if r.Header.Get("Content-Encoding") != "gzip" || r.Header.Get("X-Body-SHA256") != hex.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	client := New().SetBaseURL(srv.URL).EnableRequestCompression(0).SetSigner(func(req *http.Request) error {
+		body, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		req.Header.Set("X-Body-SHA256", hex.EncodeToString(sum[:]))
+		return nil
+	})
+	resp, err := client.Post(context.Background(), "/", Headers{"Content-Type": "text/plain"}, strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want the signature to cover the compressed body", resp.StatusCode)
+	}
+
+	req, err := client.BuildRequest(context.Background(), http.MethodPost, "/", Headers{"Content-Type": "text/plain"}, strings.NewReader("it's"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	command, err := AsCurl(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(command, `printf %s 'it'\''s' | gzip | curl -X 'POST'`) || !strings.HasSuffix(command, " --data-binary @-") {
+		t.Fatalf("got %s", command)
+	}
+}
+
+type warnings []string
+
+func (w *warnings) Warnf(format string, args ...any) {
+	*w = append(*w, fmt.Sprintf(format, args...))
+}
+
+func TestDecompressResponseEncodings(t *testing.T) {
+	const payload = "hello, world"
+	once, err := gzipBytes([]byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	twice, err := gzipBytes(once)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		encoding []string
+		body     []byte
+		want     []byte
+		warn     bool
+	}{
+		{name: "none", body: []byte(payload), want: []byte(payload)},
+		{name: "identity", encoding: []string{"identity"}, body: []byte(payload), want: []byte(payload)},
+		{name: "empty", encoding: []string{""}, body: []byte(payload), want: []byte(payload)},
+		{name: "gzip", encoding: []string{"gzip"}, body: once, want: []byte(payload)},
+		{name: "gzip, gzip", encoding: []string{"gzip, gzip"}, body: twice, want: []byte(payload)},
+		{name: "gzip and gzip headers", encoding: []string{"gzip", "gzip"}, body: twice, want: []byte(payload)},
+		{name: "identity, gzip", encoding: []string{"identity, gzip"}, body: once, want: []byte(payload)},
+		{name: "unknown", encoding: []string{"br"}, body: once, want: once, warn: true},
+		{name: "gzip, unknown", encoding: []string{"gzip, br"}, body: once, want: once, warn: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &http.Response{
+				Header: http.Header{"Content-Encoding": tc.encoding},
+				Body:   io.NopCloser(bytes.NewReader(tc.body)),
+			}
+			var logger warnings
+			decompressResponse(resp, &logger)
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, tc.want) {
+				t.Fatalf("got body %q, want %q", data, tc.want)
+			}
+			if warned := len(logger) > 0; warned != tc.warn {
+				t.Fatalf("got warnings %q, want a warning: %v", logger, tc.warn)
+			}
+			if !tc.warn && resp.Header.Get("Content-Encoding") != "" {
+				t.Fatalf("Content-Encoding %q left on a decoded body", resp.Header.Get("Content-Encoding"))
+			}
+		})
+	}
+}
+
+func TestGzipDecoderMultistream(t *testing.T) {
+	first, err := gzipBytes([]byte("first member, "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := gzipBytes([]byte("second member"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Leave a reader with multistream turned off in the pool, so the stream is
+	// decoded through the Reset path and must not stop at the first member.
+	stale, err := gzip.NewReader(bytes.NewReader(first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.Multistream(false)
+	gzipReaderPool.Put(stale)
+
+	for i := 0; i < 2; i++ {
+		reader, release, err := newGzipDecoder(bytes.NewReader(append(append([]byte(nil), first...), second...)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(reader)
+		release()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "first member, second member" {
+			t.Fatalf("got %q, want both members", data)
+		}
+	}
+}
+
+var benchmarkPayload = bytes.Repeat([]byte(`{"key":"value"}`), 2048)
+
+// The "new" cases allocate fresh gzip state per call, as a baseline for the
+// pooled paths.
+func BenchmarkNewGzipReader(b *testing.B) {
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			reader := newGzipReader(bytes.NewReader(benchmarkPayload))
+			if _, err := io.Copy(io.Discard, reader); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			writer := gzip.NewWriter(io.Discard)
+			if _, err := writer.Write(benchmarkPayload); err != nil {
+				b.Fatal(err)
+			}
+			if err := writer.Close(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkGzipDecoder(b *testing.B) {
+	compressed, err := gzipBytes(benchmarkPayload)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			reader, release, err := newGzipDecoder(bytes.NewReader(compressed))
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := io.Copy(io.Discard, reader); err != nil {
+				b.Fatal(err)
+			}
+			release()
+		}
+	})
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			reader, err := gzip.NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := io.Copy(io.Discard, reader); err != nil {
+				b.Fatal(err)
+			}
+			_ = reader.Close()
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package request
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// AsCurl renders req as an equivalent curl command, e.g. for a request made
+// by BuildRequest. The body is read through GetBody when possible; otherwise
+// it is buffered and req.Body is replaced, so req can still be sent. A
+// gzip-encoded body, as sent with EnableRequestCompression, is shown
+// uncompressed and piped through gzip.
+func AsCurl(req *http.Request) (string, error) {
+	body, err := peekRequestBody(req)
+	if err != nil {
+		return "", err
+	}
+	gzipped := len(body) > 0 && strings.EqualFold(req.Header.Get("Content-Encoding"), "gzip")
+	if gzipped {
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+		if body, err = io.ReadAll(reader); err != nil {
+			return "", err
+		}
+	}
+
+	var b strings.Builder
+	if gzipped {
+		b.WriteString("printf %s ")
+		b.WriteString(shellQuote(string(body)))
+		b.WriteString(" | gzip | ")
+	}
+	b.WriteString("curl -X ")
+	b.WriteString(shellQuote(req.Method))
+	b.WriteString(" ")
+	b.WriteString(shellQuote(req.URL.String()))
+
+	if req.Host != "" && req.Host != req.URL.Host {
+		b.WriteString(" -H ")
+		b.WriteString(shellQuote("Host: " + req.Host))
+	}
+	keys := make([]string, 0, len(req.Header))
+	for key := range req.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range req.Header[key] {
+			b.WriteString(" -H ")
+			b.WriteString(shellQuote(key + ": " + value))
+		}
+	}
+
+	switch {
+	case gzipped:
+		b.WriteString(" --data-binary @-")
+	case len(body) > 0:
+		b.WriteString(" --data-binary ")
+		b.WriteString(shellQuote(string(body)))
+	}
+	return b.String(), nil
+}
+
+func peekRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = body.Close() }()
+		return io.ReadAll(body)
+	}
+	data, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,85 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// DecoderFunc decodes a whole response body into v.
+type DecoderFunc func(data []byte, v any) error
+
+var defaultDecoders = map[string]DecoderFunc{
+	"application/json": json.Unmarshal,
+	"application/xml":  xml.Unmarshal,
+	"text/xml":         xml.Unmarshal,
+}
+
+type clientKey struct{}
+
+// RegisterDecoder makes Resp.Decode use fn for responses of mediaType, e.g.
+// "application/msgpack". It replaces any decoder registered for the same
+// type, including the default JSON and XML ones.
+func (r *Client) RegisterDecoder(mediaType string, fn DecoderFunc) *Client {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	decoders := make(map[string]DecoderFunc, len(r.decoders)+1)
+	for key, value := range r.decoders {
+		decoders[key] = value
+	}
+	decoders[strings.ToLower(mediaType)] = fn
+	r.decoders = decoders
+	return r
+}
+
+func (r *Client) decoder(mediaType string) (DecoderFunc, bool) {
+	r.mux.Lock()
+	fn, ok := r.decoders[mediaType]
+	r.mux.Unlock()
+	if !ok {
+		fn, ok = defaultDecoders[mediaType]
+	}
+	return fn, ok
+}
+
+// Decode reads the whole body and decodes it into v with the decoder
+// registered for its Content-Type. Structured suffixes fall back to their
+// base format, so "application/problem+json" is decoded as JSON.
+func (r *Resp) Decode(v any) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		_ = r.Body.Close()
+		return fmt.Errorf("decode response: %w", err)
+	}
+
+	client := std
+	if r.Request != nil {
+		if c, ok := r.Request.Context().Value(clientKey{}).(*Client); ok {
+			client = c
+		}
+	}
+	fn, ok := client.decoder(mediaType)
+	if !ok {
+		if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+			fn, ok = client.decoder("application/" + mediaType[i+1:])
+		}
+	}
+	if !ok {
+		_ = r.Body.Close()
+		return fmt.Errorf("no decoder registered for %s", mediaType)
+	}
+
+	body, err := r.ReadAll()
+	if err != nil {
+		return err
+	}
+	return fn(body, v)
+}
+
+func withClient(ctx context.Context, client *Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
@@ -0,0 +1,116 @@
+package request
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Download fetches uri into filename, resuming from a previous partial
+// download kept at filename+".part" when the server supports range requests.
+// The part file is renamed to filename only after the full body was received.
+func (r *Client) Download(ctx context.Context, uri, filename string, params ...any) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+
+	partName := filename + ".part"
+	var offset int64
+	if stat, err := os.Stat(partName); err == nil {
+		offset = stat.Size()
+	}
+
+	if offset > 0 {
+		params = append(append([]any(nil), params...), Headers{"Range": fmt.Sprintf("bytes=%d-", offset)})
+	}
+	resp, err := r.Do(ctx, http.MethodGet, uri, params...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	flag := os.O_CREATE | os.O_WRONLY
+	total := resp.ContentLength
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, end, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+		if start != offset {
+			return fmt.Errorf("unexpected content range %q for offset %d", resp.Header.Get("Content-Range"), offset)
+		}
+		flag |= os.O_APPEND
+		if size >= 0 {
+			total = size
+		} else if end >= 0 {
+			total = end + 1
+		}
+	case http.StatusOK:
+		flag |= os.O_TRUNC
+		offset = 0
+	case http.StatusRequestedRangeNotSatisfiable:
+		if _, _, size, err := parseContentRange(resp.Header.Get("Content-Range")); err == nil && offset > 0 && size == offset {
+			return os.Rename(partName, filename)
+		}
+		_ = os.Remove(partName)
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	default:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	file, err := os.OpenFile(partName, flag, 0o644)
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if total >= 0 && offset+written != total {
+		return fmt.Errorf("incomplete download: got %d of %d bytes", offset+written, total)
+	}
+	return os.Rename(partName, filename)
+}
+
+// parseContentRange parses "bytes start-end/size" as well as the
+// "bytes */size" form. Unknown values are returned as -1.
+func parseContentRange(contentRange string) (start, end, size int64, err error) {
+	start, end, size = -1, -1, -1
+
+	spec, ok := strings.CutPrefix(contentRange, "bytes ")
+	if !ok {
+		return start, end, size, fmt.Errorf("invalid content range %q", contentRange)
+	}
+	rng, sizeStr, ok := strings.Cut(strings.TrimSpace(spec), "/")
+	if !ok {
+		return start, end, size, fmt.Errorf("invalid content range %q", contentRange)
+	}
+	if sizeStr != "*" {
+		if size, err = strconv.ParseInt(sizeStr, 10, 64); err != nil {
+			return -1, -1, -1, fmt.Errorf("invalid content range %q", contentRange)
+		}
+	}
+	if rng != "*" {
+		startStr, endStr, ok := strings.Cut(rng, "-")
+		if !ok {
+			return -1, -1, -1, fmt.Errorf("invalid content range %q", contentRange)
+		}
+		if start, err = strconv.ParseInt(startStr, 10, 64); err != nil {
+			return -1, -1, -1, fmt.Errorf("invalid content range %q", contentRange)
+		}
+		if end, err = strconv.ParseInt(endStr, 10, 64); err != nil {
+			return -1, -1, -1, fmt.Errorf("invalid content range %q", contentRange)
+		}
+	}
+	return start, end, size, nil
+}
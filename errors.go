@@ -0,0 +1,67 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const maxErrorBodySize = 64 * 1024
+
+// StatusError is returned by Resp.Error for responses outside the 2xx range.
+// Body holds at most the first 64KB of the response body.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %s", e.Status)
+}
+
+// SchemaError is returned by Resp.ValidateJSONSchema. Each violation reads
+// "instance location: message", e.g. "/items/0/id: expected integer, but
+// got string".
+type SchemaError struct {
+	Violations []string
+	err        error
+}
+
+func (e *SchemaError) Error() string {
+	return "response does not match schema: " + strings.Join(e.Violations, "; ")
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.err
+}
+
+// ErrClientClosed is returned by Do once Shutdown has been called.
+var ErrClientClosed = errors.New("client closed")
+
+// ErrBodyTooLarge and ErrBodyTimeout are returned by reads of a response body
+// that breaks the limits set with SetDownloadLimits.
+var (
+	ErrBodyTooLarge = errors.New("response body too large")
+	ErrBodyTimeout  = errors.New("response body read timed out")
+)
+
+// BalancerError is returned by HTTPBalancer when no host could serve the
+// request. Hosts lists the hosts tried, in order, and it unwraps to the
+// error of every failed attempt.
+type BalancerError struct {
+	Hosts []string
+	Errs  []error
+}
+
+func (e *BalancerError) Error() string {
+	msg := "all hosts failed [" + strings.Join(e.Hosts, ", ") + "]"
+	if len(e.Errs) > 0 {
+		msg += ": " + errors.Join(e.Errs...).Error()
+	}
+	return msg
+}
+
+func (e *BalancerError) Unwrap() []error {
+	return e.Errs
+}
@@ -0,0 +1,61 @@
+package request_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/faceair/request"
+)
+
+// sign computes an HMAC-SHA256 over the method, path and body of a request.
+func sign(key []byte, method, path string, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = io.WriteString(mac, method+"\n"+path+"\n")
+	_, _ = mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func ExampleClient_SetSigner() {
+	key := []byte("secret")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !hmac.Equal([]byte(r.Header.Get("X-Signature")), []byte(sign(key, r.Method, r.URL.Path, body))) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		_, _ = fmt.Fprintf(w, "signed %s", body)
+	}))
+	defer srv.Close()
+
+	c := request.New().SetBaseURL(srv.URL).SetSigner(func(req *http.Request) error {
+		// Read the payload through GetBody, leaving req.Body to be sent.
+		var body []byte
+		if req.GetBody != nil {
+			rc, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			defer func() { _ = rc.Close() }()
+			if body, err = io.ReadAll(rc); err != nil {
+				return err
+			}
+		}
+		req.Header.Set("X-Signature", sign(key, req.Method, req.URL.Path, body))
+		return nil
+	})
+
+	resp, err := c.Post(context.Background(), "/orders", strings.NewReader(`{"id":1}`))
+	if err != nil {
+		panic(err)
+	}
+	data, _ := resp.ReadAll()
+	fmt.Println(resp.StatusCode, string(data))
+	// Output: 200 signed {"id":1}
+}
@@ -1,9 +1,46 @@
 package request
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 var std = New()
 
+// Configure applies fn to the client behind the package-level functions.
+// Call it during initialization, before requests are sent.
+func Configure(fn func(*Client)) {
+	fn(std)
+}
+
+func SetBaseURL(baseURL string) *Client {
+	return std.SetBaseURL(baseURL)
+}
+
+func SetBaseURLs(baseURLs []string) *Client {
+	return std.SetBaseURLs(baseURLs)
+}
+
+func SetTimeout(timeout time.Duration) *Client {
+	return std.SetTimeout(timeout)
+}
+
+func SetBaseHeaders(headers Headers) *Client {
+	return std.SetBaseHeaders(headers)
+}
+
+func SetBaseQuery(query Query) *Client {
+	return std.SetBaseQuery(query)
+}
+
+func SetBasicAuth(username, password string) *Client {
+	return std.SetBasicAuth(username, password)
+}
+
+func Do(ctx context.Context, method, uri string, params ...interface{}) (*Resp, error) {
+	return std.Do(ctx, method, uri, params...)
+}
+
 func Get(ctx context.Context, uri string, params ...interface{}) (*Resp, error) {
 	return std.Get(ctx, uri, params...)
 }
@@ -23,3 +60,7 @@ func Patch(ctx context.Context, uri string, params ...interface{}) (*Resp, error
 func Delete(ctx context.Context, uri string, params ...interface{}) (*Resp, error) {
 	return std.Delete(ctx, uri, params...)
 }
+
+func R() *Builder {
+	return std.R()
+}
@@ -0,0 +1,60 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// Result is the outcome of Fetch: the decoded body of a 2xx response along
+// with its status and headers.
+type Result[T any] struct {
+	Value      T
+	StatusCode int
+	Header     http.Header
+}
+
+// SetErrorType makes Fetch decode non-2xx JSON bodies into a value returned
+// by newErr, typically a pointer to an API error struct, and return it as the
+// error. Bodies that don't decode are reported as a *StatusError.
+func (r *Client) SetErrorType(newErr func() error) *Client {
+	r.newErrorValue = newErr
+	return r
+}
+
+// Fetch sends the request through client, or the default client when it is
+// nil, and decodes a 2xx JSON body into a T. For other statuses it returns
+// the error set up with SetErrorType, or a *StatusError, together with a
+// Result that carries the status and headers. An empty body leaves Value at
+// its zero value.
+func Fetch[T any](ctx context.Context, client *Client, method, uri string, params ...any) (*Result[T], error) {
+	if client == nil {
+		client = std
+	}
+	resp, err := client.Do(ctx, method, uri, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	result := &Result[T]{StatusCode: resp.StatusCode, Header: resp.Header}
+	if err := resp.Error(); err != nil {
+		if statusErr, ok := err.(*StatusError); ok && client.newErrorValue != nil {
+			if apiErr := client.newErrorValue(); json.Unmarshal(statusErr.Body, apiErr) == nil {
+				return result, apiErr
+			}
+		}
+		return result, err
+	}
+
+	body, err := resp.ReadAll()
+	if err != nil {
+		return result, err
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &result.Value); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
@@ -1,3 +1,15 @@
 module github.com/faceair/request
 
 go 1.20
+
+require (
+	github.com/klauspost/compress v1.16.7
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/net v0.20.0
+	golang.org/x/sync v0.5.0
+	golang.org/x/text v0.14.0
+	google.golang.org/protobuf v1.34.2
+)
+
+require github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
@@ -0,0 +1,87 @@
+// Package http3 sends the requests of a request.Client over HTTP/3 (QUIC).
+// It is a separate module so the QUIC dependency, and the newer Go release it
+// needs, stay out of request itself.
+package http3
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+
+	"github.com/faceair/request"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// Enable installs an HTTP/3 transport on c, reusing the TLS settings of its
+// current transport. With fallback, a request that fails over QUIC, e.g.
+// because UDP is blocked, is sent again through the previous transport, which
+// speaks HTTP/1.1 and HTTP/2; requests whose body can't be replayed through
+// GetBody are not.
+//
+// Call it after the other transport settings: the dialer settings,
+// DNSBalancer and proxies only apply to the fallback. With HTTPBalancer the
+// request URL holds a resolved IP, and the QUIC handshake verifies the
+// certificate against request.ServerName instead.
+func Enable(c *request.Client, fallback bool) error {
+	client, ok := c.HTTPClient()
+	if !ok {
+		return errors.New("http3 requires an *http.Client")
+	}
+
+	transport := &http3.Transport{Dial: dial}
+	if base, ok := client.Transport.(*http.Transport); ok && base.TLSClientConfig != nil {
+		transport.TLSClientConfig = base.TLSClientConfig.Clone()
+	}
+	if !fallback {
+		client.Transport = transport
+		return nil
+	}
+
+	previous := client.Transport
+	if previous == nil {
+		previous = http.DefaultTransport
+	}
+	client.Transport = &fallbackTransport{h3: transport, fallback: previous}
+	return nil
+}
+
+func dial(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+	if serverName, ok := request.ServerName(ctx); ok {
+		tlsCfg = tlsCfg.Clone()
+		tlsCfg.ServerName = serverName
+	}
+	return quic.DialAddrEarly(ctx, addr, tlsCfg, cfg)
+}
+
+type fallbackTransport struct {
+	h3       *http3.Transport
+	fallback http.RoundTripper
+}
+
+func (t *fallbackTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.h3.RoundTrip(req)
+	if err == nil || req.Context().Err() != nil {
+		return resp, err
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, err
+		}
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+	return t.fallback.RoundTrip(req)
+}
+
+func (t *fallbackTransport) CloseIdleConnections() {
+	t.h3.CloseIdleConnections()
+	if closer, ok := t.fallback.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
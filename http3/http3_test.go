@@ -0,0 +1,74 @@
+package http3
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/faceair/request"
+	"github.com/faceair/request/mock"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestEnable(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	})
+	// The TLS server provides a certificate for 127.0.0.1 and the roots that
+	// trust it, and serves as the fallback target.
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(tlsServer.TLS.Clone())}
+	go func() { _ = server.Serve(conn) }()
+	defer func() { _ = server.Close() }()
+
+	newClient := func(fallback bool) *request.Client {
+		c := request.New()
+		client, _ := c.HTTPClient()
+		client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{
+			RootCAs: tlsServer.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs,
+		}
+		if err := Enable(c, fallback); err != nil {
+			t.Fatal(err)
+		}
+		if fallback {
+			// Nothing answers QUIC on the TLS server's port, so give up on
+			// the handshake quickly.
+			client.Transport.(*fallbackTransport).h3.QUICConfig = &quic.Config{HandshakeIdleTimeout: 100 * time.Millisecond}
+		}
+		return c
+	}
+
+	resp, err := newClient(false).Get(context.Background(), "https://"+conn.LocalAddr().String()+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := resp.ReadAll(); string(data) != "HTTP/3.0" {
+		t.Fatalf("server saw %q, want HTTP/3.0", data)
+	}
+
+	resp, err = newClient(true).Get(context.Background(), tlsServer.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := resp.ReadAll(); string(data) != "HTTP/1.1" {
+		t.Fatalf("server saw %q, want the HTTP/1.1 fallback", data)
+	}
+}
+
+func TestEnableRequiresHTTPClient(t *testing.T) {
+	c := request.New().SetBaseClient(mock.New())
+	if err := Enable(c, false); err == nil {
+		t.Fatal("got no error for a client without an *http.Client")
+	}
+}
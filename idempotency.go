@@ -0,0 +1,65 @@
+package request
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+type idempotencyKey struct{}
+
+type idempotencyValue struct {
+	header string
+	key    string
+}
+
+// EnableIdempotencyKeys attaches a random UUID under headerName
+// ("Idempotency-Key" when empty) to every POST and PATCH request that does
+// not carry one yet. The key lives on the request context, so every retry of
+// the same Do call sends the same key.
+func (r *Client) EnableIdempotencyKeys(headerName string) *Client {
+	if headerName == "" {
+		headerName = "Idempotency-Key"
+	}
+	r.idempotencyHeader = headerName
+	return r
+}
+
+func (r *Client) withIdempotencyKey(req *http.Request) (*http.Request, error) {
+	if r.idempotencyHeader == "" || (req.Method != http.MethodPost && req.Method != http.MethodPatch) {
+		return req, nil
+	}
+	if req.Header.Get(r.idempotencyHeader) != "" {
+		return req, nil
+	}
+
+	key, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(context.WithValue(req.Context(), idempotencyKey{}, idempotencyValue{header: r.idempotencyHeader, key: key}))
+	req.Header.Set(r.idempotencyHeader, key)
+	return req, nil
+}
+
+func applyIdempotencyKey(req *http.Request) {
+	if v, ok := req.Context().Value(idempotencyKey{}).(idempotencyValue); ok {
+		req.Header.Set(v.header, v.key)
+	}
+}
+
+func hasIdempotencyKey(req *http.Request) bool {
+	_, ok := req.Context().Value(idempotencyKey{}).(idempotencyValue)
+	return ok
+}
+
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,107 @@
+package request
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type jsonPathSegment struct {
+	key   string
+	index int
+}
+
+// GetJSONField decodes the value at path, e.g. "data.items[0].id", into v.
+// The body is tokenized as it streams in and reading stops once the value is
+// found, so the rest of a large document is never buffered.
+func (r *Resp) GetJSONField(path string, v any) error {
+	defer func() { _ = r.Body.Close() }()
+
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(r.Body)
+	for _, segment := range segments {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		if segment.index >= 0 {
+			if tok != json.Delim('[') {
+				return fmt.Errorf("json path %q not found", path)
+			}
+			for i := 0; ; i++ {
+				if !dec.More() {
+					return fmt.Errorf("json path %q not found", path)
+				}
+				if i == segment.index {
+					break
+				}
+				if err := skipJSONValue(dec); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if tok != json.Delim('{') {
+			return fmt.Errorf("json path %q not found", path)
+		}
+		for {
+			if !dec.More() {
+				return fmt.Errorf("json path %q not found", path)
+			}
+			keyTok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if key, _ := keyTok.(string); key == segment.key {
+				break
+			}
+			if err := skipJSONValue(dec); err != nil {
+				return err
+			}
+		}
+	}
+	return dec.Decode(v)
+}
+
+func skipJSONValue(dec *json.Decoder) error {
+	var raw json.RawMessage
+	return dec.Decode(&raw)
+}
+
+func parseJSONPath(path string) ([]jsonPathSegment, error) {
+	var segments []jsonPathSegment
+	for _, part := range strings.Split(path, ".") {
+		key, rest, _ := strings.Cut(part, "[")
+		if key != "" {
+			segments = append(segments, jsonPathSegment{key: key, index: -1})
+		} else if rest == "" {
+			return nil, fmt.Errorf("invalid json path %q", path)
+		}
+		for rest != "" {
+			indexStr, after, ok := strings.Cut(rest, "]")
+			if !ok {
+				return nil, fmt.Errorf("invalid json path %q", path)
+			}
+			index, err := strconv.Atoi(indexStr)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid json path %q", path)
+			}
+			segments = append(segments, jsonPathSegment{index: index})
+			if after == "" {
+				break
+			}
+			if !strings.HasPrefix(after, "[") {
+				return nil, fmt.Errorf("invalid json path %q", path)
+			}
+			rest = after[1:]
+		}
+	}
+	return segments, nil
+}
@@ -0,0 +1,32 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestJSONSeqReaderStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	items := make(chan any, 1)
+	items <- map[string]int{"a": 1}
+	reader := newJSONSeqReader(ctx, items)
+	defer func() { _ = reader.Close() }()
+
+	buf := make([]byte, 64)
+	n, err := reader.Read(buf)
+	if err != nil || string(buf[:n]) != "\x1e" {
+		t.Fatalf("got %q, %v, want the record separator", buf[:n], err)
+	}
+	if n, err = reader.Read(buf); err != nil || string(buf[:n]) != "{\"a\":1}\n" {
+		t.Fatalf("got %q, %v, want the first item", buf[:n], err)
+	}
+
+	// The producer stops sending without closing items.
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := io.ReadAll(reader); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v once the context is done", err, context.Canceled)
+	}
+}
@@ -0,0 +1,26 @@
+package request
+
+// Logger receives warnings about conditions the client recovers from, such as
+// balancer ejections or serving stale DNS answers. Nothing is logged unless a
+// logger is set with Client.SetLogger.
+type Logger interface {
+	Warnf(format string, args ...any)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Warnf(string, ...any) {}
+
+func (r *Client) SetLogger(logger Logger) *Client {
+	if logger == nil {
+		logger = nopLogger{}
+	}
+	r.logger = logger
+	if r.dnsBalancer != nil {
+		r.dnsBalancer.logger = logger
+	}
+	if balancer, ok := r.http.(*HTTPBalancer); ok {
+		balancer.logger = logger
+	}
+	return r
+}
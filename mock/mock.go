@@ -0,0 +1,203 @@
+// Package mock provides a fake HTTP backend for testing code built on
+// request, without starting a server:
+//
+//	transport := mock.New()
+//	transport.On("GET", "/users").WithQuery("page", "2").Reply(200, request.MapJSON{"users": []string{}})
+//	client := request.New().SetBaseURL("http://api.test").SetBaseClient(transport)
+//
+// Transport also implements http.RoundTripper, so it can back an
+// *http.Client as well.
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+type Transport struct {
+	mu     sync.Mutex
+	routes []*Route
+	calls  []Call
+}
+
+// Call is a request received by Transport.
+type Call struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   []byte
+}
+
+// Route matches requests and holds the response sent for them. Routes are
+// tried in the order they were registered.
+type Route struct {
+	method string
+	path   string
+	query  url.Values
+	body   []byte
+
+	status int
+	header http.Header
+	reply  []byte
+	err    error
+}
+
+func New() *Transport {
+	return &Transport{}
+}
+
+// On registers a route for method and URL path, replying 200 with an empty
+// body until Reply says otherwise.
+func (t *Transport) On(method, path string) *Route {
+	route := &Route{method: method, path: path, status: http.StatusOK, header: make(http.Header)}
+	t.mu.Lock()
+	t.routes = append(t.routes, route)
+	t.mu.Unlock()
+	return route
+}
+
+// WithQuery only matches requests whose query has key set to value.
+func (r *Route) WithQuery(key, value string) *Route {
+	if r.query == nil {
+		r.query = make(url.Values)
+	}
+	r.query.Add(key, value)
+	return r
+}
+
+// WithBody only matches requests with exactly this body.
+func (r *Route) WithBody(body string) *Route {
+	r.body = []byte(body)
+	return r
+}
+
+// Reply sets the response status and body. A string or []byte body is sent
+// as is, and anything else is encoded as JSON.
+func (r *Route) Reply(status int, body any) *Route {
+	r.status = status
+	switch v := body.(type) {
+	case nil:
+		r.reply = nil
+	case string:
+		r.reply = []byte(v)
+	case []byte:
+		r.reply = v
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			r.err = err
+			return r
+		}
+		r.reply = data
+		if r.header.Get("Content-Type") == "" {
+			r.header.Set("Content-Type", "application/json; charset=utf-8")
+		}
+	}
+	return r
+}
+
+// ReplyHeader adds a header to the response.
+func (r *Route) ReplyHeader(key, value string) *Route {
+	r.header.Add(key, value)
+	return r
+}
+
+// ReplyError makes matching requests fail with err instead of a response.
+func (r *Route) ReplyError(err error) *Route {
+	r.err = err
+	return r
+}
+
+func (r *Route) match(req *http.Request, body []byte) bool {
+	if r.method != req.Method || r.path != req.URL.Path {
+		return false
+	}
+	query := req.URL.Query()
+	for key, values := range r.query {
+		for _, value := range values {
+			if !contains(query[key], value) {
+				return false
+			}
+		}
+	}
+	return r.body == nil || bytes.Equal(r.body, body)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Do records req and answers it from the first matching route. Requests that
+// match no route fail with an error.
+func (t *Transport) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t.mu.Lock()
+	t.calls = append(t.calls, Call{Method: req.Method, URL: req.URL, Header: req.Header.Clone(), Body: body})
+	var route *Route
+	for _, r := range t.routes {
+		if r.match(req, body) {
+			route = r
+			break
+		}
+	}
+	t.mu.Unlock()
+
+	if route == nil {
+		return nil, fmt.Errorf("mock: no route for %s %s", req.Method, req.URL)
+	}
+	if route.err != nil {
+		return nil, route.err
+	}
+	header := route.header.Clone()
+	header.Set("Content-Length", strconv.Itoa(len(route.reply)))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", route.status, http.StatusText(route.status)),
+		StatusCode:    route.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(route.reply)),
+		ContentLength: int64(len(route.reply)),
+		Request:       req,
+	}, nil
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.Do(req)
+}
+
+// Calls returns the requests received so far, in order.
+func (t *Transport) Calls() []Call {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Call(nil), t.calls...)
+}
+
+// Reset forgets all routes and recorded calls.
+func (t *Transport) Reset() {
+	t.mu.Lock()
+	t.routes = nil
+	t.calls = nil
+	t.mu.Unlock()
+}
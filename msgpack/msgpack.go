@@ -0,0 +1,38 @@
+// Package msgpack adds MessagePack request and response bodies to request.
+// It lives in its own package so the encoder is only linked in by callers
+// that import it.
+package msgpack
+
+import (
+	"github.com/faceair/request"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const ContentType = "application/msgpack"
+
+type body struct {
+	v any
+}
+
+// Body is a request param that encodes v as the MessagePack request body.
+func Body(v any) *body {
+	return &body{v: v}
+}
+
+func (b *body) MarshalBody() ([]byte, string, error) {
+	data, err := msgpack.Marshal(b.v)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, ContentType, nil
+}
+
+// Decode reads the whole response body and decodes it into v, the
+// MessagePack counterpart of Resp.ToJSON.
+func Decode(resp *request.Resp, v any) error {
+	data, err := resp.ReadAll()
+	if err != nil {
+		return err
+	}
+	return msgpack.Unmarshal(data, v)
+}
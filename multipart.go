@@ -0,0 +1,58 @@
+package request
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+)
+
+// MultipartBuilder builds a multipart/form-data body whose parts are written
+// in insertion order. Unlike MapMultipartForm, a field name may repeat.
+type MultipartBuilder struct {
+	parts []multipartPart
+}
+
+type multipartPart struct {
+	name     string
+	value    string
+	filename string
+	reader   io.Reader
+}
+
+func NewMultipartBuilder() *MultipartBuilder {
+	return &MultipartBuilder{}
+}
+
+func (b *MultipartBuilder) AddField(name, value string) *MultipartBuilder {
+	b.parts = append(b.parts, multipartPart{name: name, value: value})
+	return b
+}
+
+func (b *MultipartBuilder) AddFile(name, filename string, reader io.Reader) *MultipartBuilder {
+	b.parts = append(b.parts, multipartPart{name: name, filename: filename, reader: reader})
+	return b
+}
+
+func (b *MultipartBuilder) encode() (*bytes.Buffer, string, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for _, part := range b.parts {
+		if part.reader == nil {
+			if err := writer.WriteField(part.name, part.value); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+		field, err := writer.CreateFormFile(part.name, part.filename)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := io.Copy(field, part.reader); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return &buf, writer.FormDataContentType(), nil
+}
@@ -0,0 +1,87 @@
+package request
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// NextPageURL returns the target of the rel="next" entry in the Link header,
+// resolved against the request URL.
+func (r *Resp) NextPageURL() (string, bool) {
+	for _, header := range r.Header.Values("Link") {
+		// Targets may contain commas, so entries are split on the "<" that
+		// starts each one instead.
+		for {
+			start := strings.IndexByte(header, '<')
+			end := strings.IndexByte(header, '>')
+			if start < 0 || end < start {
+				break
+			}
+			target, attrs := header[start+1:end], header[end+1:]
+			if next := strings.IndexByte(attrs, '<'); next >= 0 {
+				attrs, header = attrs[:next], attrs[next:]
+			} else {
+				header = ""
+			}
+			if !isNextLink(attrs) {
+				continue
+			}
+			if r.Request == nil || r.Request.URL == nil {
+				return target, true
+			}
+			u, err := r.Request.URL.Parse(target)
+			if err != nil {
+				return "", false
+			}
+			return u.String(), true
+		}
+	}
+	return "", false
+}
+
+func isNextLink(attrs string) bool {
+	for _, attr := range strings.Split(strings.TrimRight(strings.TrimSpace(attrs), ","), ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(attr), "=")
+		if !strings.EqualFold(strings.TrimSpace(name), "rel") {
+			continue
+		}
+		for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(value), `"`)) {
+			if strings.EqualFold(rel, "next") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Paginate GETs uri and then every rel="next" link in turn, calling fn with
+// each page until there is no next link or fn returns an error. The body is
+// closed after fn returns. Query params only apply to the first request, as
+// next links carry their own query.
+func (r *Client) Paginate(ctx context.Context, uri string, fn func(*Resp) error, params ...any) error {
+	nextParams := []any{AbsoluteURL}
+	for _, param := range params {
+		switch param.(type) {
+		case Query, QueryAny, QueryAppend, *queryStruct, PathParams:
+		default:
+			nextParams = append(nextParams, param)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for {
+		resp, err := r.Do(ctx, http.MethodGet, uri, params...)
+		if err != nil {
+			return err
+		}
+		next, ok := resp.NextPageURL()
+		err = fn(resp)
+		_ = resp.Body.Close()
+		if err != nil || !ok || seen[next] {
+			return err
+		}
+		seen[next] = true
+		uri, params = next, nextParams
+	}
+}
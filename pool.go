@@ -0,0 +1,40 @@
+package request
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBufferSize keeps buffers grown by unusually large bodies out of
+// the pool, so one big response doesn't pin its memory for good.
+const maxPooledBufferSize = 1 << 20
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// ReadAllPooled reads the whole body into a buffer taken from a shared pool.
+// The returned slice is only valid until release is called: copy anything
+// that must outlive it, and don't call release more than once.
+func (r *Resp) ReadAllPooled() ([]byte, func(), error) {
+	defer func() { _ = r.Body.Close() }()
+
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if r.ContentLength > 0 && r.ContentLength <= maxPooledBufferSize {
+		buf.Grow(int(r.ContentLength) + bytes.MinRead)
+	}
+	release := func() {
+		if buf.Cap() <= maxPooledBufferSize {
+			bufferPool.Put(buf)
+		}
+	}
+
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		release()
+		return nil, func() {}, err
+	}
+	return buf.Bytes(), release, nil
+}
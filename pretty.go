@@ -0,0 +1,136 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+// PrettyJSON streams the body to w as indented JSON. The body is re-encoded
+// token by token, so large documents are never held in memory; a body made
+// of several JSON values, like NDJSON, is written one value after another.
+// A Content-Type other than JSON is rejected before anything is read.
+func (r *Resp) PrettyJSON(w io.Writer, indent string) error {
+	defer func() { _ = r.Body.Close() }()
+
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || !isJSONMediaType(mediaType) {
+			return fmt.Errorf("response is not JSON: Content-Type %q", contentType)
+		}
+	}
+
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	p := &jsonPrinter{w: bufio.NewWriter(w), indent: indent}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF && len(p.stack) == 0 {
+			break
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return fmt.Errorf("invalid JSON body: %w", err)
+		}
+		if err := p.write(tok); err != nil {
+			return err
+		}
+	}
+	return p.w.Flush()
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") || mediaType == "application/x-ndjson"
+}
+
+type jsonFrame struct {
+	object bool
+	count  int
+	// value is set in an object once its key has been written.
+	value bool
+}
+
+type jsonPrinter struct {
+	w      *bufio.Writer
+	indent string
+	stack  []jsonFrame
+}
+
+func (p *jsonPrinter) write(tok json.Token) error {
+	if delim, ok := tok.(json.Delim); ok && (delim == '}' || delim == ']') {
+		frame := p.stack[len(p.stack)-1]
+		p.stack = p.stack[:len(p.stack)-1]
+		if frame.count > 0 {
+			p.newline()
+		}
+		_ = p.w.WriteByte(byte(delim))
+		p.endValue()
+		return nil
+	}
+
+	if n := len(p.stack); n > 0 {
+		frame := &p.stack[n-1]
+		if !frame.object || !frame.value {
+			if frame.count > 0 {
+				_ = p.w.WriteByte(',')
+			}
+			frame.count++
+			p.newline()
+		}
+		if frame.object && !frame.value {
+			if err := p.scalar(tok); err != nil {
+				return err
+			}
+			_, _ = p.w.WriteString(": ")
+			frame.value = true
+			return nil
+		}
+	}
+
+	if delim, ok := tok.(json.Delim); ok {
+		_ = p.w.WriteByte(byte(delim))
+		p.stack = append(p.stack, jsonFrame{object: delim == '{'})
+		return nil
+	}
+	if err := p.scalar(tok); err != nil {
+		return err
+	}
+	p.endValue()
+	return nil
+}
+
+func (p *jsonPrinter) endValue() {
+	if len(p.stack) == 0 {
+		_ = p.w.WriteByte('\n')
+		return
+	}
+	p.stack[len(p.stack)-1].value = false
+}
+
+func (p *jsonPrinter) newline() {
+	_ = p.w.WriteByte('\n')
+	for range p.stack {
+		_, _ = p.w.WriteString(p.indent)
+	}
+}
+
+func (p *jsonPrinter) scalar(tok json.Token) error {
+	if number, ok := tok.(json.Number); ok {
+		_, err := p.w.WriteString(number.String())
+		return err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(tok); err != nil {
+		return err
+	}
+	_, err := p.w.Write(bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}))
+	return err
+}
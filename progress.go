@@ -0,0 +1,80 @@
+package request
+
+import (
+	"io"
+	"time"
+)
+
+// ProgressFunc reports transfer progress. total is -1 when the size isn't
+// known up front.
+type ProgressFunc func(done, total int64)
+
+// Progress callbacks fire at most every progressBytes bytes or
+// progressInterval, whichever comes first, and once more at the end.
+const (
+	progressBytes    = 64 * 1024
+	progressInterval = 100 * time.Millisecond
+)
+
+type progressReader struct {
+	io.Reader
+	fn       ProgressFunc
+	total    int64
+	done     int64
+	reported int64
+	last     time.Time
+}
+
+func newProgressReader(r io.Reader, total int64, fn ProgressFunc) *progressReader {
+	return &progressReader{Reader: r, fn: fn, total: total, reported: -1, last: time.Now()}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.Reader.Read(b)
+	p.done += int64(n)
+	if err == io.EOF || p.done-p.reported >= progressBytes || (n > 0 && time.Since(p.last) >= progressInterval) {
+		p.report()
+	}
+	return n, err
+}
+
+func (p *progressReader) report() {
+	if p.done == p.reported {
+		return
+	}
+	p.reported = p.done
+	p.last = time.Now()
+	p.fn(p.done, p.total)
+}
+
+// withUploadProgress reports the request body as the transport reads it,
+// starting over when a retry or redirect gets a fresh body from GetBody.
+func withUploadProgress(body io.ReadCloser, getBody GetBody, total int64, fn ProgressFunc) (io.ReadCloser, GetBody) {
+	if total <= 0 {
+		total = -1
+	}
+	body = &readCloser{Reader: newProgressReader(body, total, fn), Closer: body}
+	if getBody != nil {
+		inner := getBody
+		getBody = func() (io.ReadCloser, error) {
+			body, err := inner()
+			if err != nil {
+				return nil, err
+			}
+			return &readCloser{Reader: newProgressReader(body, total, fn), Closer: body}, nil
+		}
+	}
+	return body, getBody
+}
+
+// ToFileWithProgress works like ToFile and reports the bytes written so far,
+// with the Content-Length as total, or -1 when the length isn't known.
+func (r *Resp) ToFileWithProgress(filename string, fn func(downloaded, total int64)) error {
+	defer func() { _ = r.Body.Close() }()
+
+	total := r.ContentLength
+	if total < 0 {
+		total = -1
+	}
+	return writeFileAtomic(filename, newProgressReader(r.Body, total, fn))
+}
@@ -0,0 +1,38 @@
+// Package protobuf adds Protocol Buffers request and response bodies to
+// request. It lives in its own package so the protobuf runtime is only
+// linked in by callers that import it.
+package protobuf
+
+import (
+	"github.com/faceair/request"
+	"google.golang.org/protobuf/proto"
+)
+
+const ContentType = "application/x-protobuf"
+
+type body struct {
+	msg proto.Message
+}
+
+// Body is a request param that encodes msg as the request body.
+func Body(msg proto.Message) *body {
+	return &body{msg: msg}
+}
+
+func (b *body) MarshalBody() ([]byte, string, error) {
+	data, err := proto.Marshal(b.msg)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, ContentType, nil
+}
+
+// Decode reads the whole response body and unmarshals it into msg, the
+// protobuf counterpart of Resp.ToJSON.
+func Decode(resp *request.Resp, msg proto.Message) error {
+	data, err := resp.ReadAll()
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(data, msg)
+}
@@ -0,0 +1,61 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/proxy"
+)
+
+// SetProxyURL sends every request through the proxy at proxyURL. http and
+// https proxies are set as Transport.Proxy. socks5 and socks5h proxies
+// replace the dialer instead, and since the proxy resolves host names, the
+// DNS balancer isn't used with them.
+func (r *Client) SetProxyURL(proxyURL string) *Client {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		r.setErr(err)
+		return r
+	}
+	transport := r.transport()
+	if transport == nil {
+		r.setErr(errors.New("proxy requires an *http.Transport"))
+		return r
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		transport.Proxy = http.ProxyURL(u)
+		if r.socksProxy != nil {
+			r.socksProxy = nil
+			r.resetDialer()
+		}
+	case "socks5", "socks5h":
+		transport.Proxy = nil
+		r.socksProxy = u
+		r.resetDialer()
+	default:
+		r.setErr(fmt.Errorf("unsupported proxy scheme %q", u.Scheme))
+	}
+	return r
+}
+
+// SetProxyFunc sets Transport.Proxy, choosing the proxy for each request,
+// e.g. per destination host. A nil URL sends the request directly.
+func (r *Client) SetProxyFunc(fn func(*http.Request) (*url.URL, error)) *Client {
+	transport := r.transport()
+	if transport == nil {
+		r.setErr(errors.New("proxy requires an *http.Transport"))
+		return r
+	}
+	transport.Proxy = fn
+	return r
+}
+
+func (r *Client) socksDialContext() DialContext {
+	// FromURL only fails for schemes SetProxyURL already rejected.
+	dialer, _ := proxy.FromURL(r.socksProxy, r.newDialer())
+	return dialer.(proxy.ContextDialer).DialContext
+}
@@ -0,0 +1,145 @@
+package request_test
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/faceair/request"
+)
+
+// socks5Server accepts unauthenticated CONNECT requests and records the
+// addresses it was asked to connect to.
+type socks5Server struct {
+	ln      net.Listener
+	mu      sync.Mutex
+	targets []string
+}
+
+func newSOCKS5Server(t *testing.T) *socks5Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &socks5Server{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *socks5Server) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	// Greeting: version, method count, methods. Reply with "no auth".
+	buf := make([]byte, 262)
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return
+	}
+	if _, err := conn.Write([]byte{5, 0}); err != nil {
+		return
+	}
+
+	// Request: version, CONNECT, reserved, address type, address, port.
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return
+	}
+	var host string
+	switch buf[3] {
+	case 1:
+		if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+			return
+		}
+		host = net.IP(buf[:4]).String()
+	case 3:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return
+		}
+		n := int(buf[0])
+		if _, err := io.ReadFull(conn, buf[:n]); err != nil {
+			return
+		}
+		host = string(buf[:n])
+	default:
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(buf[:2]))))
+	s.mu.Lock()
+	s.targets = append(s.targets, target)
+	s.mu.Unlock()
+
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer func() { _ = upstream.Close() }()
+	if _, err := conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		return
+	}
+	go func() { _, _ = io.Copy(upstream, conn) }()
+	_, _ = io.Copy(conn, upstream)
+}
+
+func TestSetProxyURL(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("target"))
+	}))
+	defer target.Close()
+	// The HTTP proxy answers every request itself.
+	httpProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("http proxy"))
+	}))
+	defer httpProxy.Close()
+	socks := newSOCKS5Server(t)
+	defer func() { _ = socks.ln.Close() }()
+
+	_, port, _ := net.SplitHostPort(target.Listener.Addr().String())
+	uri := "http://localhost:" + port + "/"
+	socksURL := "socks5://" + socks.ln.Addr().String()
+
+	c := request.New()
+	for i, tc := range []struct {
+		proxyURL string
+		want     string
+	}{
+		{httpProxy.URL, "http proxy"},
+		{socksURL, "target"},
+		{httpProxy.URL, "http proxy"},
+		{socksURL, "target"},
+	} {
+		c.SetProxyURL(tc.proxyURL)
+		resp, err := c.Get(context.Background(), uri, request.CloseConnection)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if data, _ := resp.ReadAll(); string(data) != tc.want {
+			t.Fatalf("step %d through %s: got %q, want %q", i, tc.proxyURL, data, tc.want)
+		}
+	}
+
+	socks.mu.Lock()
+	defer socks.mu.Unlock()
+	// The host name is passed to the proxy rather than resolved locally.
+	if len(socks.targets) != 2 || socks.targets[0] != "localhost:"+port {
+		t.Fatalf("SOCKS5 proxy was asked for %q, want localhost:%s twice", socks.targets, port)
+	}
+}
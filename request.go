@@ -1,6 +1,7 @@
 package request
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/tls"
@@ -16,22 +17,53 @@ import (
 	"net/http/cookiejar"
 	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
+
+	"golang.org/x/sync/singleflight"
 )
 
 // inspired by https://github.com/imroc/req
 
+const Version = "0.1.0"
+
+const defaultUserAgent = "request/" + Version
+
+const defaultDNSMaxStale = 5 * time.Minute
+
 type (
 	Headers          map[string]string
 	Query            map[string]string
 	MapJSON          map[string]any
 	MapForm          map[string]string
 	MapMultipartForm map[string]any
+	PathParams       map[string]string
 	GetBody          func() (io.ReadCloser, error)
 )
 
+// QueryAny and MapFormAny are like Query and MapForm, but format their
+// values: numbers and bools as in strconv, time.Time as RFC 3339, and slices
+// as repeated keys.
+type (
+	QueryAny   map[string]any
+	MapFormAny map[string]any
+)
+
+// A Query param is merged into the query of the URI: its keys replace the
+// values the URI has for them and the other keys are kept. QueryAppend adds
+// its values instead, so a key may end up repeated; Query and QueryAny still
+// override the keys they set. The merged query is re-encoded with its keys
+// sorted.
+type QueryAppend url.Values
+
+// Host is a param that sets the Host header of a single request, taking
+// precedence over SetHostHeader and a "Host" entry in the headers.
+type Host string
+
 type bodyJSON struct {
 	v any
 }
@@ -40,6 +72,71 @@ func BodyJSON(v any) *bodyJSON {
 	return &bodyJSON{v: v}
 }
 
+type rawBody struct {
+	contentType string
+	data        []byte
+}
+
+// RawBody sends data as is with the given Content-Type, unless the request
+// sets one through its headers.
+func RawBody(contentType string, data []byte) *rawBody {
+	return &rawBody{contentType: contentType, data: data}
+}
+
+func (b *rawBody) MarshalBody() ([]byte, string, error) {
+	return b.data, b.contentType, nil
+}
+
+type bodyJSONGzip struct {
+	v any
+}
+
+// BodyJSONGzip sends v as a gzip-compressed JSON body.
+func BodyJSONGzip(v any) *bodyJSONGzip {
+	return &bodyJSONGzip{v: v}
+}
+
+type bodyJSONSeq struct {
+	items <-chan any
+}
+
+// BodyJSONSeq streams the values received from items as an RFC 7464 JSON
+// text sequence until items is closed. The body is produced as it is sent,
+// so it cannot be replayed for retries or redirects. If a value fails to
+// encode the request fails with that error; the sender should stop once the
+// request's context is done, as values are no longer received then.
+func BodyJSONSeq(items <-chan any) *bodyJSONSeq {
+	return &bodyJSONSeq{items: items}
+}
+
+type absoluteURL struct{}
+
+// AbsoluteURL is a param that makes Do send the uri as given, without
+// prefixing it with a base URL.
+var AbsoluteURL = absoluteURL{}
+
+type skipBaseHeaders struct{}
+
+// SkipBaseHeaders is a param that leaves out the headers set with
+// SetBaseHeaders and SetBasicAuth, e.g. for an unauthenticated endpoint.
+// SkipHeaders leaves out only the named ones.
+var SkipBaseHeaders = skipBaseHeaders{}
+
+type SkipHeaders []string
+
+type closeConnection struct{}
+
+// CloseConnection is a param that sends "Connection: close" and closes the
+// connection after the response instead of returning it to the pool.
+var CloseConnection = closeConnection{}
+
+// BodyMarshaler is a param that encodes its own request body, letting other
+// packages add body formats. The Content-Type is only set when the request
+// doesn't carry one already.
+type BodyMarshaler interface {
+	MarshalBody() (body []byte, contentType string, err error)
+}
+
 type HTTPClient interface {
 	Do(*http.Request) (*http.Response, error)
 }
@@ -65,15 +162,75 @@ func New() *Client {
 			Transport: transport,
 			Timeout:   time.Minute,
 		},
+		logger:      nopLogger{},
+		userAgent:   defaultUserAgent,
+		dnsMaxStale: defaultDNSMaxStale,
+		dialTimeout: time.Second,
 	}
 }
 
 type Client struct {
 	mux       sync.Mutex
+	err       error
 	http      HTTPClient
+	logger    Logger
 	baseURLs  []string
 	currIndex int
 	headers   Headers
+	query     Query
+	userAgent string
+	host      string
+	// baseAuths holds the Authorization value built from the userinfo of
+	// each base URL, or "" when it has none.
+	baseAuths []string
+
+	contentType string
+	accept      string
+
+	idempotencyHeader string
+
+	cache       Cache
+	retry       *retryConfig
+	retryBudget time.Duration
+	onRetry     func(ctx context.Context, attempt int, resp *Resp, err error) error
+	zstd        bool
+	compressReq *requestCompression
+	autoDrain   bool
+	flight      *singleflight.Group
+
+	expectContinue   bool
+	sniffContentType bool
+	bodyIdleTimeout  time.Duration
+	requestTimeout   time.Duration
+	maxBodyBytes     int64
+	maxBodyDuration  time.Duration
+	sem              chan struct{}
+
+	interceptor      func(req *http.Request) error
+	signer           func(req *http.Request) error
+	responseBodyFunc func(resp *http.Response) (io.ReadCloser, error)
+	onResponse       func(resp *http.Response) error
+	statusHandlers   map[int]func(*Resp) error
+	newErrorValue    func() error
+	decoders         map[string]DecoderFunc
+
+	// dnsBalanced is the transport whose dialer already goes through
+	// dnsBalancer, so repeated SetBaseURLs calls don't wrap it again.
+	dnsBalanced *http.Transport
+	dnsBalancer *DNSBalancer
+	dnsMaxStale time.Duration
+	randSeed    *int64
+	dialTimeout time.Duration
+	dialRetry   int
+	dialDelay   time.Duration
+	localAddr   net.Addr
+	socksProxy  *url.URL
+	unixSocket  string
+
+	stopCleanup chan struct{}
+	closed      bool
+	inflight    int
+	drained     chan struct{}
 }
 
 func (r *Client) SetBaseURL(baseURL string) *Client {
@@ -81,49 +238,134 @@ func (r *Client) SetBaseURL(baseURL string) *Client {
 	return r
 }
 
+// SetBaseURLs sets the base URLs relative URIs are resolved against, taking
+// turns between them. Userinfo in a base URL is removed from it and sent as
+// basic auth with the requests for that base URL only, unless SetBasicAuth
+// is in use.
 func (r *Client) SetBaseURLs(baseURLs []string) *Client {
-	r.baseURLs = baseURLs
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.baseURLs = make([]string, 0, len(baseURLs))
+	r.baseAuths = make([]string, 0, len(baseURLs))
+	for _, baseURL := range baseURLs {
+		var auth string
+		if u, err := url.Parse(baseURL); err == nil && u.User != nil {
+			password, _ := u.User.Password()
+			auth = basicAuth(u.User.Username(), password)
+			u.User = nil
+			baseURL = u.String()
+		}
+		r.baseURLs = append(r.baseURLs, baseURL)
+		r.baseAuths = append(r.baseAuths, auth)
+	}
+	r.currIndex = 0
 
 	if httpClient, ok := r.http.(*http.Client); ok {
-		if httpTransport, ok := httpClient.Transport.(*http.Transport); ok {
+		if httpTransport, ok := httpClient.Transport.(*http.Transport); ok && httpTransport != r.dnsBalanced {
 			var dialContext DialContext
 			if httpTransport.DialContext != nil {
 				dialContext = httpTransport.DialContext
 			} else {
-				dialContext = (&net.Dialer{
-					Timeout:   time.Second,
-					KeepAlive: 30 * time.Second,
-					DualStack: true,
-				}).DialContext
+				dialContext = r.newDialer().DialContext
 			}
-			balancer := newDNSBalancer(dialContext)
-			httpTransport.DialContext = balancer.DialContext
+			r.dnsBalancer = newDNSBalancer(dialContext, r.dnsMaxStale)
+			r.dnsBalancer.logger = r.logger
+			r.dnsBalancer.SetDialRetry(r.dialRetry, r.dialDelay)
+			r.seedRnd(r.dnsBalancer.rnd)
+			httpTransport.DialContext = r.dnsBalancer.DialContext
+			r.dnsBalanced = httpTransport
 		}
 	}
 	return r
 }
 
+// EnableHTTPBalance spreads requests over the hosts of the base URLs, sending
+// each one to a resolved IP of a host; lookups are cached for cacheExpire.
+// Certificates are verified against the base URL host rather than the IP,
+// unless SetInsecureSkipVerify opts out. Connections are pooled by IP and
+// port, so a connection verified for one host may be reused for another host
+// resolving to the same address: only balance hosts with distinct addresses
+// or a certificate covering all of them.
 func (r *Client) EnableHTTPBalance(cacheExpire time.Duration) *Client {
 	if httpClient, ok := r.http.(*http.Client); ok {
 		if httpTransport, ok := httpClient.Transport.(*http.Transport); ok {
-			httpTransport.TLSClientConfig = &tls.Config{
-				InsecureSkipVerify: true,
-			}
+			httpTransport.DialTLSContext = newTLSDialer(httpTransport)
 		}
 	}
 
-	if len(r.baseURLs) == 0 {
-		panic("http balancer requires base urls")
+	r.mux.Lock()
+	baseURLs, baseAuths := r.baseURLs, r.baseAuths
+	r.mux.Unlock()
+
+	if len(baseURLs) == 0 {
+		r.setErr(errors.New("http balancer requires base urls"))
+		return r
+	}
+	// The balancer may send a request to any of the hosts, so they must all
+	// accept the same credentials.
+	for _, auth := range baseAuths {
+		if auth != baseAuths[0] {
+			r.setErr(errors.New("http balancer requires the same userinfo in every base url"))
+			return r
+		}
 	}
-	hosts := make([]string, 0, len(r.baseURLs))
-	for _, baseURL := range r.baseURLs {
+	hosts := make([]string, 0, len(baseURLs))
+	for _, baseURL := range baseURLs {
 		baseU, err := url.Parse(baseURL)
 		if err != nil {
-			panic(err)
+			r.setErr(err)
+			return r
 		}
 		hosts = append(hosts, baseU.Host)
 	}
-	r.http = newHTTPBalancer(r.http, hosts, cacheExpire)
+	balancer := newHTTPBalancer(r.http, hosts, cacheExpire, r.dnsMaxStale)
+	balancer.logger = r.logger
+	r.seedRnd(balancer.rnd)
+	r.http = balancer
+	return r
+}
+
+// SetRandSeed seeds the random source the balancers shuffle hosts and IPs
+// with, including balancers created later, so tests can rely on a fixed
+// order. By default the source is seeded from the current time.
+func (r *Client) SetRandSeed(seed int64) *Client {
+	r.randSeed = &seed
+	if r.dnsBalancer != nil {
+		r.dnsBalancer.rnd.Seed(seed)
+	}
+	if balancer, ok := r.http.(*HTTPBalancer); ok {
+		balancer.rnd.Seed(seed)
+	}
+	return r
+}
+
+func (r *Client) seedRnd(rnd *safeRnd) {
+	if r.randSeed != nil {
+		rnd.Seed(*r.randSeed)
+	}
+}
+
+// setErr records a configuration error. Setters keep returning the client
+// for chaining, and the error is reported by every following Do.
+func (r *Client) setErr(err error) {
+	r.mux.Lock()
+	if r.err == nil {
+		r.err = err
+	}
+	r.mux.Unlock()
+}
+
+// SetDNSMaxStale sets how long the balancers keep serving previously resolved
+// IPs after DNS lookups start failing. Zero disables serving stale answers.
+func (r *Client) SetDNSMaxStale(maxStale time.Duration) *Client {
+	r.dnsMaxStale = maxStale
+	if r.dnsBalancer != nil {
+		r.dnsBalancer.SetMaxStale(maxStale)
+	}
+	if balancer, ok := r.http.(*HTTPBalancer); ok {
+		balancer.SetMaxStale(maxStale)
+	}
 	return r
 }
 
@@ -133,61 +375,414 @@ func (r *Client) SetBaseClient(client HTTPClient) *Client {
 }
 
 func (r *Client) SetTimeout(timeout time.Duration) *Client {
-	var underClient *http.Client
-	switch client := r.http.(type) {
-	case *http.Client:
-		underClient = client
-	case *HTTPBalancer:
-		underClient = client.httpClient.(*http.Client)
+	underClient, ok := r.HTTPClient()
+	if !ok {
+		r.setErr(errors.New("timeout requires an *http.Client"))
+		return r
 	}
 	underClient.Timeout = timeout
 	return r
 }
 
+// SetCheckRedirect sets the CheckRedirect policy of the underlying
+// http.Client, which can inspect each redirect before it is followed and
+// stop with http.ErrUseLastResponse to get the redirect response itself.
+func (r *Client) SetCheckRedirect(fn func(req *http.Request, via []*http.Request) error) *Client {
+	underClient, ok := r.HTTPClient()
+	if !ok {
+		r.setErr(errors.New("check redirect requires an *http.Client"))
+		return r
+	}
+	underClient.CheckRedirect = fn
+	return r
+}
+
 func (r *Client) SetDialTimeout(timeout time.Duration) *Client {
-	var underClient *http.Client
-	switch client := r.http.(type) {
-	case *http.Client:
-		underClient = client
-	case *HTTPBalancer:
-		underClient = client.httpClient.(*http.Client)
+	r.dialTimeout = timeout
+	r.resetDialer()
+	return r
+}
+
+// SetDialRetry makes the DNS balancer dial each resolved IP up to attempts
+// times, waiting delay in between, while the connection is refused, before it
+// moves on to the next IP. This rides out backends that are briefly down,
+// e.g. during a rolling restart. The wait never goes past the context
+// deadline.
+func (r *Client) SetDialRetry(attempts int, delay time.Duration) *Client {
+	r.dialRetry, r.dialDelay = attempts, delay
+	if r.dnsBalancer != nil {
+		r.dnsBalancer.SetDialRetry(attempts, delay)
 	}
-	underClient.Transport.(*http.Transport).DialContext = newDNSBalancer((&net.Dialer{
-		Timeout:   timeout,
+	return r
+}
+
+// SetLocalAddr makes outgoing connections originate from addr, e.g. a
+// *net.TCPAddr with only the IP set. It is kept when SetDialTimeout or
+// SetBaseURLs rebuild the dialer.
+func (r *Client) SetLocalAddr(addr net.Addr) *Client {
+	r.localAddr = addr
+	r.resetDialer()
+	return r
+}
+
+// SetUnixSocket sends every request over the unix domain socket at path,
+// whatever the URL host, e.g. with a base URL of "http://localhost". The URL
+// path and query are sent as the request URI as usual.
+func (r *Client) SetUnixSocket(path string) *Client {
+	r.unixSocket = path
+	r.resetDialer()
+	return r
+}
+
+func (r *Client) newDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   r.dialTimeout,
+		LocalAddr: r.localAddr,
 		KeepAlive: 30 * time.Second,
 		DualStack: true,
-	}).DialContext).DialContext
+	}
+}
+
+func (r *Client) resetDialer() {
+	transport := r.transport()
+	if transport == nil {
+		r.setErr(errors.New("dialer settings require an *http.Transport"))
+		return
+	}
+	if r.unixSocket != "" {
+		path, dialer := r.unixSocket, &net.Dialer{Timeout: r.dialTimeout}
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", path)
+		}
+		r.dnsBalancer = nil
+		r.dnsBalanced = transport
+		return
+	}
+	if r.socksProxy != nil {
+		transport.DialContext = r.socksDialContext()
+		r.dnsBalancer = nil
+		r.dnsBalanced = transport
+		return
+	}
+	r.dnsBalancer = newDNSBalancer(r.newDialer().DialContext, r.dnsMaxStale)
+	r.dnsBalancer.logger = r.logger
+	r.dnsBalancer.SetDialRetry(r.dialRetry, r.dialDelay)
+	r.seedRnd(r.dnsBalancer.rnd)
+	transport.DialContext = r.dnsBalancer.DialContext
+	r.dnsBalanced = transport
+}
+
+// DisableKeepAlives makes every request use a fresh connection, which is
+// closed once the response has been read.
+func (r *Client) DisableKeepAlives() *Client {
+	if transport := r.transport(); transport != nil {
+		transport.DisableKeepAlives = true
+	}
 	return r
 }
 
 func (r *Client) SetMaxIdleConns(maxIdleConns int) *Client {
-	var underClient *http.Client
-	switch client := r.http.(type) {
+	if transport := r.transport(); transport != nil {
+		transport.MaxIdleConns = maxIdleConns
+	}
+	return r
+}
+
+func (r *Client) SetMaxIdleConnsPerHost(maxIdleConnsPerHost int) *Client {
+	if transport := r.transport(); transport != nil {
+		transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	}
+	return r
+}
+
+// SetMaxConnsPerHost limits the connections per host, including those in
+// use. Requests beyond the limit wait for a connection to become available.
+func (r *Client) SetMaxConnsPerHost(maxConnsPerHost int) *Client {
+	if transport := r.transport(); transport != nil {
+		transport.MaxConnsPerHost = maxConnsPerHost
+	}
+	return r
+}
+
+// SetResponseHeaderTimeout limits the time to wait for the response headers
+// once the request has been written, per attempt. Zero means no limit.
+func (r *Client) SetResponseHeaderTimeout(timeout time.Duration) *Client {
+	if transport := r.transport(); transport != nil {
+		transport.ResponseHeaderTimeout = timeout
+	}
+	return r
+}
+
+// SetMaxResponseHeaderBytes limits the size of the response headers. Zero
+// means the net/http default.
+func (r *Client) SetMaxResponseHeaderBytes(n int64) *Client {
+	if transport := r.transport(); transport != nil {
+		transport.MaxResponseHeaderBytes = n
+	}
+	return r
+}
+
+func (r *Client) SetInsecureSkipVerify(skip bool) *Client {
+	if config := r.tlsConfig(); config != nil {
+		config.InsecureSkipVerify = skip
+	}
+	return r
+}
+
+func (r *Client) SetTLSVersions(minVersion, maxVersion uint16) *Client {
+	if config := r.tlsConfig(); config != nil {
+		config.MinVersion = minVersion
+		config.MaxVersion = maxVersion
+	}
+	return r
+}
+
+// SetCipherSuites restricts the TLS 1.0-1.2 cipher suites. TLS 1.3 suites
+// are not configurable in crypto/tls.
+func (r *Client) SetCipherSuites(ids []uint16) *Client {
+	if config := r.tlsConfig(); config != nil {
+		config.CipherSuites = append([]uint16(nil), ids...)
+	}
+	return r
+}
+
+// tlsConfig returns the TLS config of the transport, creating it if needed.
+// Without an *http.Transport it records an error, since silently dropping a
+// setting like a minimum TLS version is not safe.
+func (r *Client) tlsConfig() *tls.Config {
+	transport := r.transport()
+	if transport == nil {
+		r.setErr(errors.New("tls settings require an *http.Transport"))
+		return nil
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	return transport.TLSClientConfig
+}
+
+// Balancer returns the HTTPBalancer installed by EnableHTTPBalance.
+func (r *Client) Balancer() (*HTTPBalancer, bool) {
+	balancer, ok := r.http.(*HTTPBalancer)
+	return balancer, ok
+}
+
+// HTTPClient returns the *http.Client requests are sent with, looking
+// through an HTTPBalancer. ok is false when a custom HTTPClient is in use.
+// The returned client shares its transport and connection pool with r, so
+// changes to it apply to every request r sends.
+func (r *Client) HTTPClient() (client *http.Client, ok bool) {
+	switch c := r.http.(type) {
 	case *http.Client:
-		underClient = client
+		return c, true
 	case *HTTPBalancer:
-		underClient = client.httpClient.(*http.Client)
+		client, ok = c.httpClient.(*http.Client)
+		return client, ok
+	}
+	return nil, false
+}
+
+func (r *Client) transport() *http.Transport {
+	underClient, ok := r.HTTPClient()
+	if !ok {
+		return nil
 	}
-	underClient.Transport.(*http.Transport).MaxIdleConns = maxIdleConns
-	underClient.Transport.(*http.Transport).MaxConnsPerHost = maxIdleConns
+	transport, _ := underClient.Transport.(*http.Transport)
+	return transport
+}
+
+type idleCloser interface {
+	CloseIdleConnections()
+}
+
+func (r *Client) CloseIdleConnections() {
+	if closer, ok := r.http.(idleCloser); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// SetIdleConnCleanup closes idle connections every interval in a background
+// goroutine. A non-positive interval stops a previously started cleanup.
+func (r *Client) SetIdleConnCleanup(interval time.Duration) *Client {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.stopCleanup != nil {
+		close(r.stopCleanup)
+		r.stopCleanup = nil
+	}
+	if interval <= 0 {
+		return r
+	}
+
+	stop := make(chan struct{})
+	r.stopCleanup = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.CloseIdleConnections()
+			case <-stop:
+				return
+			}
+		}
+	}()
 	return r
 }
 
 func (r *Client) SetBasicAuth(username, password string) *Client {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
 	if r.headers == nil {
 		r.headers = make(Headers)
 	}
-	r.headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	r.headers["Authorization"] = basicAuth(username, password)
+	return r
+}
+
+func basicAuth(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+// SetHostHeader sends host as the Host header of every request instead of the
+// URL host, e.g. to reach a virtual host through an IP. The Host param
+// overrides it per request.
+func (r *Client) SetHostHeader(host string) *Client {
+	r.host = host
+	return r
+}
+
+func (r *Client) SetUserAgent(userAgent string) *Client {
+	r.userAgent = userAgent
+	return r
+}
+
+// SetDefaultContentType sets the Content-Type of request bodies that don't
+// get one from their param type or from the request headers, such as raw
+// string and []byte bodies.
+func (r *Client) SetDefaultContentType(contentType string) *Client {
+	r.contentType = contentType
+	return r
+}
+
+func (r *Client) SetDefaultAccept(accept string) *Client {
+	r.accept = accept
+	return r
+}
+
+// SetRequestInterceptor registers a function that sees the fully built request,
+// including the final URL and query, right before it is signed and sent.
+// Returning an error aborts the request.
+func (r *Client) SetRequestInterceptor(interceptor func(req *http.Request) error) *Client {
+	r.interceptor = interceptor
+	return r
+}
+
+// SetSigner registers a function that signs every request once its URL and
+// headers are final. In-memory bodies always come with GetBody, so the signer
+// can hash the payload through req.GetBody without consuming req.Body.
+func (r *Client) SetSigner(signer func(req *http.Request) error) *Client {
+	r.signer = signer
+	return r
+}
+
+// SetResponseBodyFunc replaces every response body with the reader returned
+// by fn, e.g. to decrypt or checksum it. The body is already decompressed
+// when EnableZstd is on. An error from fn fails the request.
+func (r *Client) SetResponseBodyFunc(fn func(resp *http.Response) (io.ReadCloser, error)) *Client {
+	r.responseBodyFunc = fn
+	return r
+}
+
+// SetOnResponse registers fn to inspect every response as soon as its
+// headers arrive, e.g. to track a rate-limit budget. fn must not read the
+// body. An error from fn fails the request and closes the body.
+func (r *Client) SetOnResponse(fn func(resp *http.Response) error) *Client {
+	r.onResponse = fn
+	return r
+}
+
+// OnStatus registers fn to run when a response has the given status code,
+// replacing an earlier handler for it. The body is buffered first, so fn can
+// read it and the caller still gets it whole. An error from fn fails the
+// request.
+func (r *Client) OnStatus(code int, fn func(*Resp) error) *Client {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	handlers := make(map[int]func(*Resp) error, len(r.statusHandlers)+1)
+	for key, value := range r.statusHandlers {
+		handlers[key] = value
+	}
+	handlers[code] = fn
+	r.statusHandlers = handlers
+	return r
+}
+
+// SetAutoDrain buffers up to 64KB of every non-2xx response body and drains
+// the rest, so error responses never hold on to a pooled connection.
+func (r *Client) SetAutoDrain(autoDrain bool) *Client {
+	r.autoDrain = autoDrain
+	return r
+}
+
+// SetExpectContinue sends "Expect: 100-continue" with every request that has
+// a body, so the transport holds the body back until the server accepts the
+// headers or ExpectContinueTimeout passes.
+func (r *Client) SetExpectContinue(expectContinue bool) *Client {
+	r.expectContinue = expectContinue
+	return r
+}
+
+// SetMaxConcurrency caps the number of requests in flight at n; Do waits for
+// a free slot or for its context to be done. A slot is held until the
+// response body is closed, not just until the headers arrive, so callers
+// must close every body. n <= 0 removes the cap.
+func (r *Client) SetMaxConcurrency(n int) *Client {
+	if n <= 0 {
+		r.sem = nil
+	} else {
+		r.sem = make(chan struct{}, n)
+	}
+	return r
+}
+
+// SetSniffContentType sets the Content-Type of requests whose body has none
+// from its first 512 bytes, see http.DetectContentType. Those bytes are
+// buffered and then sent ahead of the rest of the body.
+func (r *Client) SetSniffContentType(sniff bool) *Client {
+	r.sniffContentType = sniff
+	return r
+}
+
+// SetBaseQuery adds query parameters to every request. They have the lowest
+// precedence: a key the URI or a query param sets, even through QueryAppend,
+// is left alone.
+func (r *Client) SetBaseQuery(query Query) *Client {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.query == nil {
+		r.query = make(Query, len(query))
+	}
+	for k, v := range query {
+		r.query[k] = v
+	}
 	return r
 }
 
 func (r *Client) SetBaseHeaders(headers Headers) *Client {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
 	if r.headers == nil {
-		r.headers = headers
-	} else {
-		for k, v := range headers {
-			r.headers[k] = v
-		}
+		r.headers = make(Headers, len(headers))
+	}
+	for k, v := range headers {
+		r.headers[k] = v
 	}
 	return r
 }
@@ -213,9 +808,103 @@ func (r *Client) Delete(ctx context.Context, uri string, params ...any) (*Resp,
 }
 
 func (r *Client) Do(ctx context.Context, method, uri string, params ...any) (*Resp, error) {
+	if !r.enter() {
+		return nil, ErrClientClosed
+	}
+	releases := []func(){r.leave}
+	if sem := r.sem; sem != nil {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			r.leave()
+			return nil, ctx.Err()
+		}
+		releases = append(releases, func() { <-sem })
+	}
+	if r.retryBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.retryBudget)
+		releases = append(releases, cancel)
+	}
+	var headerTimer *time.Timer
+	if r.requestTimeout > 0 {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		headerTimer = time.AfterFunc(r.requestTimeout, func() { cancel(r.requestTimeoutErr()) })
+		releases = append(releases, func() { cancel(nil) })
+	}
+	done := releaseOnce(releases)
+
+	resp, err := r.do(ctx, method, uri, params...)
+	if headerTimer != nil && !headerTimer.Stop() {
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		done()
+		return nil, context.Cause(ctx)
+	}
+	if err != nil {
+		done()
+		return nil, withContextErr(ctx, err)
+	}
+	resp.Body = newCancelOnClose(resp.Body, done)
+	return resp, nil
+}
+
+// withContextErr makes a failure caused by ctx ending match ctx.Err() with
+// errors.Is, even when it surfaced as a dial error or as the error of an
+// earlier attempt.
+func withContextErr(ctx context.Context, err error) error {
+	ctxErr := ctx.Err()
+	if ctxErr == nil || errors.Is(err, ctxErr) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ctxErr, err)
+}
+
+// cancelOnClose releases a context once the body it was used for is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// cancelOnCloseWriter keeps the body of a 101 response writable.
+type cancelOnCloseWriter struct {
+	*cancelOnClose
+	io.Writer
+}
+
+func newCancelOnClose(body io.ReadCloser, cancel context.CancelFunc) io.ReadCloser {
+	wrapped := &cancelOnClose{ReadCloser: body, cancel: cancel}
+	if writer, ok := body.(io.Writer); ok {
+		return &cancelOnCloseWriter{cancelOnClose: wrapped, Writer: writer}
+	}
+	return wrapped
+}
+
+// BuildRequest runs params through the same pipeline as Do and returns the
+// request Do would send, without sending it. Like Do, it moves on to the
+// next base URL when several are set.
+func (r *Client) BuildRequest(ctx context.Context, method, uri string, params ...any) (*http.Request, error) {
 	var bodyReader io.Reader
 	var queryParam Query
+	var queryAny url.Values
+	var queryValues url.Values
+	var pathParams PathParams
+	var skipBaseURL bool
+	var skipAllHeaders bool
+	var skipHeaders map[string]bool
 	var getBody GetBody
+	var hostParam Host
+	var retryParam *Retry
+	var closeConn bool
+	var progress ProgressFunc
 
 	headerParam := make(http.Header)
 	for _, param := range params {
@@ -234,6 +923,53 @@ func (r *Client) Do(ctx context.Context, method, uri string, params ...any) (*Re
 			}
 		case Query:
 			queryParam = v
+		case QueryAny:
+			values, err := encodeValues(map[string]any(v), "url")
+			if err != nil {
+				return nil, err
+			}
+			queryAny = values
+		case PathParams:
+			pathParams = v
+		case absoluteURL:
+			skipBaseURL = true
+		case skipBaseHeaders:
+			skipAllHeaders = true
+		case SkipHeaders:
+			if skipHeaders == nil {
+				skipHeaders = make(map[string]bool, len(v))
+			}
+			for _, key := range v {
+				skipHeaders[http.CanonicalHeaderKey(key)] = true
+			}
+		case Host:
+			hostParam = v
+		case Retry:
+			retryParam = &v
+		case closeConnection:
+			closeConn = true
+		case ProgressFunc:
+			progress = v
+		case func(done, total int64):
+			progress = v
+		case QueryAppend:
+			if queryValues == nil {
+				queryValues = make(url.Values)
+			}
+			for key, value := range v {
+				queryValues[key] = append(queryValues[key], value...)
+			}
+		case *queryStruct:
+			values, err := encodeValues(v.v, "url")
+			if err != nil {
+				return nil, err
+			}
+			if queryValues == nil {
+				queryValues = make(url.Values)
+			}
+			for key, value := range values {
+				queryValues[key] = append(queryValues[key], value...)
+			}
 		case *bodyJSON, MapJSON:
 			if vv, ok := param.(*bodyJSON); ok {
 				v = vv.v
@@ -246,6 +982,25 @@ func (r *Client) Do(ctx context.Context, method, uri string, params ...any) (*Re
 			if contentType := headerParam.Get("Content-Type"); contentType == "" {
 				headerParam.Set("Content-Type", "application/json; charset=utf-8")
 			}
+		case *bodyJSONGzip:
+			jsonValue, err := json.Marshal(v.v)
+			if err != nil {
+				return nil, err
+			}
+			compressed, err := gzipBytes(jsonValue)
+			if err != nil {
+				return nil, err
+			}
+			bodyReader = bytes.NewReader(compressed)
+			if contentType := headerParam.Get("Content-Type"); contentType == "" {
+				headerParam.Set("Content-Type", "application/json; charset=utf-8")
+			}
+			headerParam.Set("Content-Encoding", "gzip")
+		case *bodyJSONSeq:
+			bodyReader = newJSONSeqReader(ctx, v.items)
+			if contentType := headerParam.Get("Content-Type"); contentType == "" {
+				headerParam.Set("Content-Type", "application/json-seq")
+			}
 		case MapForm:
 			form := url.Values{}
 			for key, value := range v {
@@ -255,6 +1010,24 @@ func (r *Client) Do(ctx context.Context, method, uri string, params ...any) (*Re
 			if contentType := headerParam.Get("Content-Type"); contentType == "" {
 				headerParam.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
 			}
+		case MapFormAny:
+			form, err := encodeValues(map[string]any(v), "form")
+			if err != nil {
+				return nil, err
+			}
+			bodyReader = strings.NewReader(form.Encode())
+			if contentType := headerParam.Get("Content-Type"); contentType == "" {
+				headerParam.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+			}
+		case *bodyForm:
+			form, err := encodeValues(v.v, "form")
+			if err != nil {
+				return nil, err
+			}
+			bodyReader = strings.NewReader(form.Encode())
+			if contentType := headerParam.Get("Content-Type"); contentType == "" {
+				headerParam.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+			}
 		case MapMultipartForm:
 			var buf bytes.Buffer
 			writer := multipart.NewWriter(&buf)
@@ -291,61 +1064,468 @@ func (r *Client) Do(ctx context.Context, method, uri string, params ...any) (*Re
 			if contentType := headerParam.Get("Content-Type"); contentType == "" {
 				headerParam.Set("Content-Type", writer.FormDataContentType())
 			}
+		case *MultipartBuilder:
+			buf, contentType, err := v.encode()
+			if err != nil {
+				return nil, err
+			}
+			bodyReader = buf
+			if headerParam.Get("Content-Type") == "" {
+				headerParam.Set("Content-Type", contentType)
+			}
+		case BodyMarshaler:
+			body, contentType, err := v.MarshalBody()
+			if err != nil {
+				return nil, err
+			}
+			bodyReader = bytes.NewReader(body)
+			if headerParam.Get("Content-Type") == "" && contentType != "" {
+				headerParam.Set("Content-Type", contentType)
+			}
 		case GetBody:
 			getBody = v
 		default:
-			return nil, fmt.Errorf("unknown param %v", param)
+			if !isJSONBody(param) {
+				return nil, fmt.Errorf("unknown param %v", param)
+			}
+			jsonValue, err := json.Marshal(param)
+			if err != nil {
+				return nil, err
+			}
+			bodyReader = bytes.NewReader(jsonValue)
+			if contentType := headerParam.Get("Content-Type"); contentType == "" {
+				headerParam.Set("Content-Type", "application/json; charset=utf-8")
+			}
+		}
+	}
+
+	if pathParams != nil {
+		var err error
+		if uri, err = expandPath(uri, pathParams); err != nil {
+			return nil, err
 		}
 	}
 
-	if u, _ := url.Parse(uri); u != nil && u.Scheme == "" {
-		if len(r.baseURLs) == 1 {
-			uri = r.baseURLs[0] + uri
-		} else if len(r.baseURLs) > 1 {
-			r.mux.Lock()
-			uri = r.baseURLs[r.currIndex] + uri
-			r.currIndex = (r.currIndex + 1) % len(r.baseURLs)
-			r.mux.Unlock()
-		}
+	r.mux.Lock()
+	if r.err != nil {
+		r.mux.Unlock()
+		return nil, r.err
+	}
+	var baseAuth string
+	if u, _ := url.Parse(uri); u != nil && u.Scheme == "" && !skipBaseURL {
+		if len(r.baseURLs) == 0 {
+			r.mux.Unlock()
+			return nil, fmt.Errorf("relative URI %q but no base URL configured", uri)
+		} else if len(r.baseURLs) == 1 {
+			uri, baseAuth = r.baseURLs[0]+uri, r.baseAuths[0]
+		} else {
+			uri, baseAuth = r.baseURLs[r.currIndex]+uri, r.baseAuths[r.currIndex]
+			r.currIndex = (r.currIndex + 1) % len(r.baseURLs)
+		}
+	}
+	baseHeaders := make(Headers, len(r.headers)+1)
+	for key, value := range r.headers {
+		if !skipAllHeaders && !skipHeaders[http.CanonicalHeaderKey(key)] {
+			baseHeaders[key] = value
+		}
+	}
+	// Credentials from a base URL only go to requests sent to that base URL,
+	// and SetBasicAuth takes precedence over them.
+	if _, ok := r.headers["Authorization"]; !ok && baseAuth != "" && !skipAllHeaders && !skipHeaders["Authorization"] {
+		baseHeaders["Authorization"] = baseAuth
+	}
+	baseQuery := make(Query, len(r.query))
+	for key, value := range r.query {
+		baseQuery[key] = value
+	}
+	r.mux.Unlock()
+
+	if retryParam != nil {
+		ctx = withRetry(ctx, *retryParam)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, uri, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	req.Close = closeConn
+	if getBody != nil {
+		req.GetBody = getBody
+	} else if req.GetBody == nil && bodyReader != nil {
+		req.GetBody = replayableBody(bodyReader)
+	}
+
+	query := req.URL.Query()
+	for key, values := range queryValues {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	for key, value := range queryParam {
+		query.Set(key, value)
+	}
+	for key, values := range queryAny {
+		query[key] = values
+	}
+	for key, value := range baseQuery {
+		if _, ok := query[key]; !ok {
+			query.Set(key, value)
+		}
+	}
+	req.URL.RawQuery = query.Encode()
+
+	for key, value := range baseHeaders {
+		req.Header.Add(key, value)
+	}
+	for key, values := range headerParam {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	if bodyReader != nil && req.Header.Get("Content-Type") == "" && r.contentType != "" {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+	if r.sniffContentType && req.Header.Get("Content-Type") == "" && req.Body != nil && req.Body != http.NoBody {
+		if err := sniffContentType(req); err != nil {
+			return nil, err
+		}
+	}
+	if r.compressReq != nil && req.Body != nil && req.Body != http.NoBody {
+		r.compressReq.apply(req)
+	}
+	if progress != nil && req.Body != nil && req.Body != http.NoBody {
+		req.Body, req.GetBody = withUploadProgress(req.Body, req.GetBody, req.ContentLength, progress)
+	}
+	if req.Header.Get("Accept") == "" && r.accept != "" {
+		req.Header.Set("Accept", r.accept)
+	}
+	if r.zstd && req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", "gzip, zstd")
+	}
+	if req.Header.Get("User-Agent") == "" && r.userAgent != "" {
+		req.Header.Set("User-Agent", r.userAgent)
+	}
+	if r.expectContinue && bodyReader != nil && req.Header.Get("Expect") == "" {
+		req.Header.Set("Expect", "100-continue")
+	}
+	if r.host != "" {
+		req.Host = r.host
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	if hostParam != "" {
+		req.Host = string(hostParam)
+	}
+
+	if req, err = r.withIdempotencyKey(req); err != nil {
+		return nil, err
+	}
+	if r.interceptor != nil {
+		if err := r.interceptor(req); err != nil {
+			return nil, err
+		}
+	}
+	if r.signer != nil {
+		if err := r.signer(req); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+func (r *Client) do(ctx context.Context, method, uri string, params ...any) (*Resp, error) {
+	req, err := r.BuildRequest(ctx, method, uri, params...)
+	if err != nil {
+		return nil, err
+	}
+	req = withBackend(req.WithContext(withClient(req.Context(), r)))
+
+	var resp *http.Response
+	if r.flight != nil && (req.Method == http.MethodGet || req.Method == http.MethodHead) && !isUpgradeRequest(req) {
+		resp, err = r.sendShared(req)
+	} else {
+		resp, err = r.sendWithRetry(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.onResponse != nil {
+		if err := r.onResponse(resp); err != nil {
+			_ = resp.Body.Close()
+			return nil, err
+		}
+	}
+	if r.bodyIdleTimeout > 0 && resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body = newIdleTimeoutBody(resp.Body, r.bodyIdleTimeout)
+	}
+	if r.zstd {
+		decompressResponse(resp, r.logger)
+	}
+	if (r.maxBodyBytes > 0 || r.maxBodyDuration > 0) && resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body = newLimitedBody(resp.Body, r.maxBodyBytes, r.maxBodyDuration)
+	}
+	if r.responseBodyFunc != nil {
+		body, err := r.responseBodyFunc(resp)
+		if err != nil {
+			_ = resp.Body.Close()
+			return nil, err
+		}
+		resp.Body = body
+	}
+	if r.autoDrain && resp.StatusCode != http.StatusSwitchingProtocols && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		if err := bufferBody(resp, maxDrainSize); err != nil {
+			return nil, err
+		}
+	}
+
+	r.mux.Lock()
+	handler := r.statusHandlers[resp.StatusCode]
+	r.mux.Unlock()
+	if handler != nil {
+		result := &Resp{resp}
+		body, err := result.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		if err := handler(result); err != nil {
+			return nil, err
+		}
+		result.Body = io.NopCloser(bytes.NewReader(body))
+		return result, nil
+	}
+	return &Resp{resp}, nil
+}
+
+const maxDrainSize = 64 * 1024
+
+// bufferBody keeps up to limit bytes of the body in memory and drains the
+// rest, so the connection goes back to the pool even if the caller never
+// reads or closes the body.
+func bufferBody(resp *http.Response, limit int64) error {
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return nil
+}
+
+func (r *Client) send(req *http.Request) (*http.Response, error) {
+	if r.cache != nil && isCacheableRequest(req) {
+		return r.sendCached(req)
 	}
+	return clientFor(req, r.http).Do(req)
+}
 
-	req, err := http.NewRequestWithContext(ctx, method, uri, bodyReader)
-	if err != nil {
-		return nil, err
+// isJSONBody reports whether an unrecognized param is a struct, map, slice
+// or array (or a pointer to one), which Do sends as a JSON body.
+func isJSONBody(param any) bool {
+	t := reflect.TypeOf(param)
+	if t == nil {
+		return false
 	}
-	if getBody != nil {
-		req.GetBody = getBody
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
 	}
-
-	query := req.URL.Query()
-	for key, value := range queryParam {
-		query.Set(key, value)
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		return true
 	}
-	req.URL.RawQuery = query.Encode()
+	return false
+}
 
-	for key, value := range r.headers {
-		req.Header.Add(key, value)
+func sniffContentType(req *http.Request) error {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(req.Body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
 	}
-	for key, values := range headerParam {
-		for _, value := range values {
-			req.Header.Add(key, value)
+	head = head[:n]
+	req.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(head), req.Body), Closer: req.Body}
+	req.Header.Set("Content-Type", http.DetectContentType(head))
+	return nil
+}
+
+// expandPath replaces {name} placeholders in uri with the path-escaped
+// values from params.
+func expandPath(uri string, params PathParams) (string, error) {
+	var sb strings.Builder
+	for {
+		start := strings.IndexByte(uri, '{')
+		if start < 0 {
+			break
 		}
+		end := strings.IndexByte(uri[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unclosed path param in %q", uri)
+		}
+		name := uri[start+1 : start+end]
+		value, ok := params[name]
+		if !ok {
+			return "", fmt.Errorf("missing path param %q", name)
+		}
+		sb.WriteString(uri[:start])
+		sb.WriteString(url.PathEscape(value))
+		uri = uri[start+end+1:]
 	}
-	if host := req.Header.Get("Host"); host != "" {
-		req.Host = host
-	}
+	sb.WriteString(uri)
+	return sb.String(), nil
+}
 
-	resp, err := r.http.Do(req)
-	if err != nil {
-		return nil, err
+// newJSONSeqReader encodes items in a goroutine that stops once items is
+// closed, the reader is closed or ctx is done, so a producer that stops
+// sending without closing items does not keep it around.
+func newJSONSeqReader(ctx context.Context, items <-chan any) io.ReadCloser {
+	pr, pw := io.Pipe()
+	closed := make(chan struct{})
+	go func() {
+		enc := json.NewEncoder(pw)
+		for {
+			var item any
+			var ok bool
+			select {
+			case item, ok = <-items:
+			case <-ctx.Done():
+				_ = pw.CloseWithError(ctx.Err())
+				return
+			case <-closed:
+				return
+			}
+			if !ok {
+				_ = pw.Close()
+				return
+			}
+			if _, err := pw.Write([]byte{0x1e}); err != nil {
+				return
+			}
+			if err := enc.Encode(item); err != nil {
+				_ = pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return &jsonSeqReader{PipeReader: pr, closed: closed}
+}
+
+type jsonSeqReader struct {
+	*io.PipeReader
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (r *jsonSeqReader) Close() error {
+	r.once.Do(func() { close(r.closed) })
+	return r.PipeReader.Close()
+}
+
+// replayableBody lets redirects and retries resend bodies that can be read
+// again. In-memory readers are already covered by http.NewRequest; files are
+// reopened because the transport closes the original after sending, and
+// readers implementing io.ReaderAt are read again from where they started
+// through an independent section, so GetBody never touches the body being
+// sent. Other readers return nil.
+func replayableBody(body io.Reader) GetBody {
+	switch v := body.(type) {
+	case *os.File:
+		offset, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil
+		}
+		name := v.Name()
+		return func() (io.ReadCloser, error) {
+			file, err := os.Open(name)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := file.Seek(offset, io.SeekStart); err != nil {
+				_ = file.Close()
+				return nil, err
+			}
+			return file, nil
+		}
+	case interface {
+		io.ReaderAt
+		io.Seeker
+	}:
+		offset, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil
+		}
+		size, err := v.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil
+		}
+		if _, err := v.Seek(offset, io.SeekStart); err != nil {
+			return nil
+		}
+		return func() (io.ReadCloser, error) {
+			return io.NopCloser(io.NewSectionReader(v, offset, size-offset)), nil
+		}
 	}
-	return &Resp{resp}, nil
+	return nil
 }
 
+// Resp embeds the *http.Response it wraps, so its fields and methods are
+// reachable directly. Methods of Resp with the same name as one of
+// http.Response take precedence; use Unwrap to pass the response to code that
+// expects net/http types.
 type Resp struct {
 	*http.Response
 }
 
+// Unwrap returns the underlying *http.Response.
+func (r *Resp) Unwrap() *http.Response {
+	return r.Response
+}
+
+// Error returns a *StatusError for non-2xx responses. The body is buffered
+// rather than consumed, so it can still be decoded afterwards.
+func (r *Resp) Error() error {
+	if r.StatusCode >= 200 && r.StatusCode <= 299 {
+		return nil
+	}
+	body, err := r.Peek(maxErrorBodySize)
+	if err != nil {
+		return err
+	}
+	return &StatusError{StatusCode: r.StatusCode, Status: r.Status, Body: body}
+}
+
+// Discard drains and closes the body. A body that is neither read to EOF nor
+// discarded keeps its connection out of the pool.
+func (r *Resp) Discard() error {
+	_, err := io.Copy(io.Discard, r.Body)
+	if closeErr := r.Body.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Trailers returns the response trailers. They only arrive after the body
+// has been read to EOF, so call it once you are done with the body: whatever
+// is left unread is discarded and the body is closed.
+func (r *Resp) Trailers() http.Header {
+	_ = r.Discard()
+	return r.Trailer
+}
+
+func (r *Resp) Cookies() []*http.Cookie {
+	return r.Response.Cookies()
+}
+
+// Cookie returns the first cookie named name set by the response.
+func (r *Resp) Cookie(name string) (*http.Cookie, bool) {
+	for _, cookie := range r.Response.Cookies() {
+		if cookie.Name == name {
+			return cookie, true
+		}
+	}
+	return nil, false
+}
+
 func (r *Resp) String() string {
 	body, _ := r.ReadAll()
 	return string(body)
@@ -356,17 +1536,66 @@ func (r *Resp) ReadAll() ([]byte, error) {
 	return io.ReadAll(r.Body)
 }
 
+// Bytes reads and closes the body like ReadAll, then replaces it with the
+// buffered bytes so the response can be read again, e.g. by ToJSON.
+func (r *Resp) Bytes() ([]byte, error) {
+	data, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
 func (r *Resp) ToFile(filename string) error {
+	return r.Save(filename, false)
+}
+
+// Save writes the body to a temporary file next to filename and renames it
+// into place once the download completes, so a failed transfer never leaves
+// a truncated file behind. With preserveModTime the file's modification time
+// is set from the Last-Modified header.
+func (r *Resp) Save(filename string, preserveModTime bool) error {
 	defer func() { _ = r.Body.Close() }()
 
-	file, err := os.Create(filename)
+	if err := writeFileAtomic(filename, r.Body); err != nil {
+		return err
+	}
+	if preserveModTime {
+		if modTime, err := http.ParseTime(r.Header.Get("Last-Modified")); err == nil {
+			return os.Chtimes(filename, modTime, modTime)
+		}
+	}
+	return nil
+}
+
+func writeFileAtomic(filename string, src io.Reader) (err error) {
+	dir := filepath.Dir(filename)
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(dir, "."+filepath.Base(filename)+".tmp-*")
 	if err != nil {
 		return err
 	}
-	defer func() { _ = file.Close() }()
+	defer func() {
+		if err != nil {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}
+	}()
 
-	_, err = io.Copy(file, r.Body)
-	return err
+	if _, err = io.Copy(file, src); err != nil {
+		return err
+	}
+	if err = file.Chmod(0o644); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filename)
 }
 
 func (r *Resp) ToJSON(v any) error {
@@ -377,18 +1606,189 @@ func (r *Resp) ToJSON(v any) error {
 	return json.Unmarshal(body, v)
 }
 
+func (r *Resp) ToMap() (map[string]any, error) {
+	var v any
+	if err := r.ToJSON(&v); err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a JSON object, got %s", jsonKind(v))
+	}
+	return m, nil
+}
+
+func (r *Resp) ToSlice() ([]any, error) {
+	var v any
+	if err := r.ToJSON(&v); err != nil {
+		return nil, err
+	}
+	s, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a JSON array, got %s", jsonKind(v))
+	}
+	return s, nil
+}
+
+func jsonKind(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
+
+// Peek reads up to n bytes from the body without consuming them: later reads
+// still see the complete body. An n <= 0 reads nothing.
+func (r *Resp) Peek(n int) ([]byte, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	buf := make([]byte, n)
+	read, err := io.ReadFull(r.Body, buf)
+	buf = buf[:read]
+	r.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(buf), r.Body), Closer: r.Body}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return buf, err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+const defaultMaxLineSize = 1024 * 1024
+
+// Stream reads the body in chunks of chunkSize bytes (32KB when <= 0), only
+// the last one being shorter, and passes each to fn. The chunk buffer is
+// reused, so fn must not keep it. An error from fn stops reading and is
+// returned. The body is closed when Stream returns.
+func (r *Resp) Stream(fn func(chunk []byte) error, chunkSize int) error {
+	defer func() { _ = r.Body.Close() }()
+
+	if chunkSize <= 0 {
+		chunkSize = 32 * 1024
+	}
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r.Body, buf)
+		if n > 0 {
+			if fnErr := fn(buf[:n]); fnErr != nil {
+				return fnErr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// JSONEach reads a newline-delimited JSON body and calls fn for every line.
+// Lines longer than maxLineSize (1MB by default) fail with bufio.ErrTooLong.
+func (r *Resp) JSONEach(fn func(raw json.RawMessage) error, maxLineSize ...int) error {
+	defer func() { _ = r.Body.Close() }()
+
+	maxSize := defaultMaxLineSize
+	if len(maxLineSize) > 0 && maxLineSize[0] > 0 {
+		maxSize = maxLineSize[0]
+	}
+	initSize := 64 * 1024
+	if initSize > maxSize {
+		initSize = maxSize
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, initSize), maxSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(append(json.RawMessage(nil), line...)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
 type DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
 
 type DNSBalancer struct {
+	mu          sync.RWMutex
 	rnd         *safeRnd
 	dialContext DialContext
+	maxStale    time.Duration
+	dialRetry   int
+	dialDelay   time.Duration
+	resolved    map[string]resolvedHost
+	logger      Logger
+}
+
+type resolvedHost struct {
+	ips []string
+	at  time.Time
 }
 
-func newDNSBalancer(dialContext DialContext) *DNSBalancer {
+func newDNSBalancer(dialContext DialContext, maxStale time.Duration) *DNSBalancer {
 	return &DNSBalancer{
 		rnd:         newSafeRnd(),
 		dialContext: dialContext,
+		maxStale:    maxStale,
+		resolved:    make(map[string]resolvedHost),
+		logger:      nopLogger{},
+	}
+}
+
+// lookupHost resolves host and, when the resolver fails, falls back to the
+// last successful answer as long as it is not older than maxStale.
+func (lb *DNSBalancer) lookupHost(ctx context.Context, host string) ([]string, error) {
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err == nil {
+		if net.ParseIP(host) == nil {
+			lb.mu.Lock()
+			lb.resolved[host] = resolvedHost{ips: append([]string(nil), ips...), at: time.Now()}
+			lb.mu.Unlock()
+		}
+		return ips, nil
+	}
+	if ctx.Err() != nil {
+		return nil, err
+	}
+
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	last, ok := lb.resolved[host]
+	if !ok || time.Since(last.at) > lb.maxStale {
+		return nil, err
 	}
+	lb.logger.Warnf("request: serving %s stale DNS answer for %s: %v%s", time.Since(last.at), host, err, formatTags(ctx))
+	return append([]string(nil), last.ips...), nil
+}
+
+func (lb *DNSBalancer) SetMaxStale(maxStale time.Duration) {
+	lb.mu.Lock()
+	lb.maxStale = maxStale
+	lb.mu.Unlock()
+}
+
+func (lb *DNSBalancer) SetDialRetry(attempts int, delay time.Duration) {
+	lb.mu.Lock()
+	lb.dialRetry, lb.dialDelay = attempts, delay
+	lb.mu.Unlock()
 }
 
 func (lb *DNSBalancer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
@@ -397,7 +1797,7 @@ func (lb *DNSBalancer) DialContext(ctx context.Context, network, addr string) (n
 		return nil, err
 	}
 
-	ips, err := net.LookupHost(host)
+	ips, err := lb.lookupHost(ctx, host)
 	if err != nil {
 		return nil, err
 	}
@@ -410,43 +1810,130 @@ func (lb *DNSBalancer) DialContext(ctx context.Context, network, addr string) (n
 		ips[i], ips[j] = ips[j], ips[i]
 	})
 
+	lb.mu.RLock()
+	attempts, delay := lb.dialRetry, lb.dialDelay
+	lb.mu.RUnlock()
+
 	var lastErr error
 	for _, ip := range ips {
-		conn, err := lb.dialContext(ctx, network, net.JoinHostPort(ip, port))
+		conn, err := lb.dialIP(ctx, network, net.JoinHostPort(ip, port), attempts, delay)
 		if err == nil {
 			return conn, nil
 		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
 		lastErr = err
 	}
 	return nil, lastErr
 }
 
+func (lb *DNSBalancer) dialIP(ctx context.Context, network, addr string, attempts int, delay time.Duration) (net.Conn, error) {
+	for attempt := 1; ; attempt++ {
+		conn, err := lb.dialContext(ctx, network, addr)
+		if err == nil || attempt >= attempts || !errors.Is(err, syscall.ECONNREFUSED) {
+			return conn, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+			return nil, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+type serverNameKey struct{}
+
+// ServerName returns the host HTTPBalancer expects the server certificate to
+// match, for custom transports that dial the resolved IP themselves.
+func ServerName(ctx context.Context) (string, bool) {
+	serverName, ok := ctx.Value(serverNameKey{}).(string)
+	return serverName, ok && serverName != ""
+}
+
+// newTLSDialer verifies certificates against the logical host stored in the
+// request context, since HTTPBalancer rewrites the URL host to a resolved IP.
+func newTLSDialer(transport *http.Transport) DialContext {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialContext := transport.DialContext
+		if dialContext == nil {
+			dialContext = (&net.Dialer{}).DialContext
+		}
+		conn, err := dialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		config := &tls.Config{}
+		if transport.TLSClientConfig != nil {
+			config = transport.TLSClientConfig.Clone()
+		}
+		if config.ServerName == "" {
+			if serverName, ok := ServerName(ctx); ok {
+				config.ServerName = serverName
+			} else if host, _, err := net.SplitHostPort(addr); err == nil {
+				config.ServerName = host
+			}
+		}
+
+		if transport.TLSHandshakeTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, transport.TLSHandshakeTimeout)
+			defer cancel()
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
+
 type HTTPBalancer struct {
 	mu           sync.RWMutex
 	rnd          *safeRnd
 	httpClient   HTTPClient
 	hosts        []string
 	cacheTTL     time.Duration
+	maxStale     time.Duration
 	cachedIPs    map[string][]string
 	cachedExpiry map[string]time.Time
+	stats        map[string]*HostStats
+	logger       Logger
 }
 
-func newHTTPBalancer(http HTTPClient, targetHosts []string, cacheTTL time.Duration) *HTTPBalancer {
+func newHTTPBalancer(http HTTPClient, targetHosts []string, cacheTTL, maxStale time.Duration) *HTTPBalancer {
 	return &HTTPBalancer{
 		rnd:          newSafeRnd(),
 		httpClient:   http,
 		hosts:        targetHosts,
 		cacheTTL:     cacheTTL,
+		maxStale:     maxStale,
 		cachedIPs:    make(map[string][]string),
 		cachedExpiry: make(map[string]time.Time),
+		stats:        make(map[string]*HostStats),
+		logger:       nopLogger{},
 	}
 }
 
+// Do sends each attempt as a clone of req pointed at one resolved IP, so req
+// itself is never modified. A request for a host the balancer does not
+// manage, e.g. one sent with AbsoluteURL, is passed through unchanged.
 func (lb *HTTPBalancer) Do(req *http.Request) (*http.Response, error) {
 	var hosts []string
 
 	lb.mu.RLock()
 	hosts = lb.hosts
+	if !containsHost(hosts, req.URL.Host) {
+		lb.mu.RUnlock()
+		return clientFor(req, lb.httpClient).Do(req)
+	}
 	if len(hosts) > 1 {
 		hosts = append([]string(nil), hosts...)
 		lb.rnd.Shuffle(len(hosts), func(i, j int) {
@@ -455,9 +1942,16 @@ func (lb *HTTPBalancer) Do(req *http.Request) (*http.Response, error) {
 	}
 	lb.mu.RUnlock()
 
-	var finalErr error
+	var errs []error
+	var attempted bool
+	// A Host that differs from the URL host was set explicitly and is kept.
+	hostOverride := req.Host != "" && req.Host != req.URL.Host
 
 	for _, host := range hosts {
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+
 		var ips []string
 
 		domain, port, _ := net.SplitHostPort(host)
@@ -476,45 +1970,177 @@ func (lb *HTTPBalancer) Do(req *http.Request) (*http.Response, error) {
 
 		if ips == nil {
 			var err error
-			ips, err = net.LookupHost(domain)
+			ips, err = net.DefaultResolver.LookupHost(req.Context(), domain)
 			if err != nil {
-				finalErr = err
-				continue
+				if ctxErr := req.Context().Err(); ctxErr != nil {
+					return nil, ctxErr
+				}
+				if ips = lb.staleIPs(req.Context(), host, err); ips == nil {
+					lb.recordEjection(req.Context(), host, err)
+					errs = append(errs, err)
+					continue
+				}
+			} else {
+				lb.mu.Lock()
+				lb.cachedIPs[host] = append([]string(nil), ips...)
+				lb.cachedExpiry[host] = time.Now().Add(lb.cacheTTL)
+				lb.mu.Unlock()
 			}
-
-			lb.mu.Lock()
-			lb.cachedIPs[host] = ips
-			lb.cachedExpiry[host] = time.Now().Add(lb.cacheTTL)
-			lb.mu.Unlock()
 		}
 
 		if len(ips) == 0 {
-			finalErr = newNoSuchHostError(host)
+			err := newNoSuchHostError(host)
+			lb.recordEjection(req.Context(), host, err)
+			errs = append(errs, err)
 			continue
 		}
 
+		ctx := context.WithValue(req.Context(), serverNameKey{}, domain)
+		if b := backendFrom(ctx); b != nil {
+			b.set(host, "")
+		}
+
 		lb.rnd.Shuffle(len(ips), func(i, j int) {
 			ips[i], ips[j] = ips[j], ips[i]
 		})
 
+		var lastErr error
 		for _, ip := range ips {
+			if err := req.Context().Err(); err != nil {
+				return nil, err
+			}
+
 			hostname := ip
 			if port != "" {
 				hostname = net.JoinHostPort(ip, port)
 			}
-			req.Host = host
-			req.URL.Host = hostname
-			resp, err := lb.httpClient.Do(req)
+			attempt := req.Clone(ctx)
+			if !hostOverride {
+				attempt.Host = host
+			}
+			attempt.URL.Host = hostname
+			if attempted && req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attempt.Body = body
+			}
+			attempted = true
+			resp, err := clientFor(attempt, lb.httpClient).Do(attempt)
+			lb.recordAttempt(host, err)
 			if err == nil {
 				return resp, err
 			}
-			if !isRetryableError(err) {
+			if req.Context().Err() != nil {
 				return nil, err
 			}
-			finalErr = err
+			if !isRetryableError(err) {
+				return nil, joinErrors(append(errs, err))
+			}
+			errs = append(errs, err)
+			lastErr = err
+		}
+		lb.recordEjection(req.Context(), host, lastErr)
+	}
+	return nil, &BalancerError{Hosts: append([]string(nil), hosts...), Errs: errs}
+}
+
+func containsHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if h == host {
+			return true
 		}
 	}
-	return nil, finalErr
+	return false
+}
+
+// joinErrors keeps a lone error as is, so callers can still type-assert it,
+// and joins several so every failed attempt is reported.
+func joinErrors(errs []error) error {
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
+
+// HostStats counts the attempts HTTPBalancer sent to a host. A host is
+// ejected when the balancer gives up on it for a request, either because it
+// could not be resolved or because dialing every one of its IPs failed.
+type HostStats struct {
+	Requests  uint64
+	Successes uint64
+	Failures  uint64
+	Ejections uint64
+}
+
+func (lb *HTTPBalancer) Stats() map[string]HostStats {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	stats := make(map[string]HostStats, len(lb.stats))
+	for host, hostStats := range lb.stats {
+		stats[host] = *hostStats
+	}
+	return stats
+}
+
+func (lb *HTTPBalancer) hostStats(host string) *HostStats {
+	stats, ok := lb.stats[host]
+	if !ok {
+		stats = &HostStats{}
+		lb.stats[host] = stats
+	}
+	return stats
+}
+
+func (lb *HTTPBalancer) recordAttempt(host string, err error) {
+	lb.mu.Lock()
+	stats := lb.hostStats(host)
+	stats.Requests++
+	if err == nil {
+		stats.Successes++
+	} else {
+		stats.Failures++
+	}
+	lb.mu.Unlock()
+}
+
+func (lb *HTTPBalancer) recordEjection(ctx context.Context, host string, err error) {
+	lb.mu.Lock()
+	lb.hostStats(host).Ejections++
+	lb.mu.Unlock()
+	lb.logger.Warnf("request: ejected host %s: %v%s", host, err, formatTags(ctx))
+}
+
+// staleIPs returns the last resolved IPs of host while they are less than
+// maxStale past their expiry, so a resolver outage doesn't fail requests.
+func (lb *HTTPBalancer) staleIPs(ctx context.Context, host string, err error) []string {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	exp, ok := lb.cachedExpiry[host]
+	if !ok || len(lb.cachedIPs[host]) == 0 {
+		return nil
+	}
+	age := time.Since(exp)
+	if age > lb.maxStale {
+		return nil
+	}
+	lb.logger.Warnf("request: serving %s stale DNS answer for %s: %v%s", age, host, err, formatTags(ctx))
+	return append([]string(nil), lb.cachedIPs[host]...)
+}
+
+func (lb *HTTPBalancer) SetMaxStale(maxStale time.Duration) {
+	lb.mu.Lock()
+	lb.maxStale = maxStale
+	lb.mu.Unlock()
+}
+
+func (lb *HTTPBalancer) CloseIdleConnections() {
+	if closer, ok := lb.httpClient.(idleCloser); ok {
+		closer.CloseIdleConnections()
+	}
 }
 
 type safeRnd struct {
@@ -526,6 +2152,12 @@ func newSafeRnd() *safeRnd {
 	return &safeRnd{rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}
 }
 
+func (r *safeRnd) Seed(seed int64) {
+	r.mux.Lock()
+	r.rnd = rand.New(rand.NewSource(seed))
+	r.mux.Unlock()
+}
+
 func (r *safeRnd) Shuffle(n int, f func(i, j int)) {
 	if n <= 1 {
 		return
@@ -542,6 +2174,13 @@ func (r *safeRnd) IntN(n int) int {
 	return n
 }
 
+func (r *safeRnd) Int63n(n int64) int64 {
+	r.mux.Lock()
+	n = r.rnd.Int63n(n)
+	r.mux.Unlock()
+	return n
+}
+
 func newNoSuchHostError(host string) error {
 	return &net.DNSError{Err: fmt.Sprintf("no such host for %q", host), Name: host, IsNotFound: true}
 }
@@ -0,0 +1,190 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Backoff returns the delay before the given retry attempt, starting at 1.
+type Backoff func(attempt int) time.Duration
+
+// ConstantBackoff waits the same duration before every retry.
+func ConstantBackoff(d time.Duration) Backoff {
+	return func(int) time.Duration {
+		return d
+	}
+}
+
+// ExponentialBackoff doubles the delay with every attempt, capped at max, and
+// applies full jitter so clients retrying together spread out. The returned
+// function is safe for concurrent use by goroutines sharing one client.
+func ExponentialBackoff(base, max time.Duration) Backoff {
+	rnd := newSafeRnd()
+	return func(attempt int) time.Duration {
+		delay := max
+		if attempt < 1 {
+			attempt = 1
+		}
+		if shift := attempt - 1; shift < 62 && base > 0 && base <= max>>shift {
+			delay = base << shift
+		}
+		if delay <= 0 {
+			return 0
+		}
+		return time.Duration(rnd.Int63n(int64(delay)))
+	}
+}
+
+type retryConfig struct {
+	attempts int
+	backoff  Backoff
+}
+
+// Retry is a param that replaces the client's SetRetry settings for a single
+// call. The zero value disables retries.
+type Retry struct {
+	Attempts int
+	Backoff  Backoff
+}
+
+type retryKey struct{}
+
+func withRetry(ctx context.Context, retry Retry) context.Context {
+	backoff := retry.Backoff
+	if backoff == nil {
+		backoff = ConstantBackoff(0)
+	}
+	return context.WithValue(ctx, retryKey{}, &retryConfig{attempts: retry.Attempts, backoff: backoff})
+}
+
+// SetRetry makes Do send a request up to attempts times when dialing fails,
+// or when an idempotent request gets 429, 502, 503 or 504. A reset
+// connection is retried for idempotent requests, requests carrying a key
+// from EnableIdempotencyKeys and requests with a body GetBody can replay.
+// Requests whose body cannot be replayed are never retried.
+func (r *Client) SetRetry(attempts int, backoff Backoff) *Client {
+	if backoff == nil {
+		backoff = ConstantBackoff(0)
+	}
+	r.retry = &retryConfig{attempts: attempts, backoff: backoff}
+	return r
+}
+
+// SetRetryBudget bounds the total time of a Do call, covering every attempt
+// and the backoff between them as well as reading the response body. When the
+// remaining budget can't cover the next backoff, the last result is returned
+// right away.
+func (r *Client) SetRetryBudget(total time.Duration) *Client {
+	r.retryBudget = total
+	return r
+}
+
+// SetOnRetry registers fn to run before the client waits for each retry, with
+// the attempt that just failed and its response or error. resp is nil when
+// the attempt failed with err. Returning an error stops retrying, and Do
+// returns that error.
+func (r *Client) SetOnRetry(fn func(ctx context.Context, attempt int, resp *Resp, err error) error) *Client {
+	r.onRetry = fn
+	return r
+}
+
+func (r *Client) sendWithRetry(req *http.Request) (*http.Response, error) {
+	retry := r.retry
+	if override, ok := req.Context().Value(retryKey{}).(*retryConfig); ok {
+		retry = override
+	}
+	if retry == nil || retry.attempts <= 1 {
+		return r.send(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := r.send(req)
+		if attempt >= retry.attempts || !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+		delay := retry.backoff(attempt)
+		if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) <= delay {
+			return resp, err
+		}
+		if r.onRetry != nil {
+			var hookResp *Resp
+			if resp != nil {
+				hookResp = &Resp{resp}
+			}
+			if hookErr := r.onRetry(req.Context(), attempt, hookResp, err); hookErr != nil {
+				if resp != nil {
+					_ = resp.Body.Close()
+				}
+				return nil, hookErr
+			}
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			if err == nil {
+				err = req.Context().Err()
+			}
+			return nil, err
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		applyIdempotencyKey(req)
+	}
+}
+
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	if err != nil {
+		if isRetryableError(err) {
+			return true
+		}
+		return isConnectionReset(err) && (isIdempotent(req.Method) || hasIdempotencyKey(req) || hasReplayableBody(req))
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return isIdempotent(req.Method)
+	}
+	return false
+}
+
+// isConnectionReset reports a connection the server dropped mid-request,
+// typically a kept-alive one it recycled: the request may have been
+// processed, so only requests that are safe to repeat are retried on it.
+// net/http does not export the error for a connection closed before the
+// response started, so it is matched by its message.
+func isConnectionReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		strings.Contains(err.Error(), "http: server closed idle connection")
+}
+
+func hasReplayableBody(req *http.Request) bool {
+	return req.Body != nil && req.Body != http.NoBody && req.GetBody != nil
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package request
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRetryConnectionReset(t *testing.T) {
+	// The server closes every connection right after accepting it.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			_ = conn.Close()
+		}
+	}()
+
+	for _, tc := range []struct {
+		name   string
+		client *Client
+		method string
+		body   func() any
+		want   int32
+	}{
+		{"GET", New(), http.MethodGet, nil, 3},
+		{"POST with a replayable body", New(), http.MethodPost, func() any { return strings.NewReader("payload") }, 3},
+		{"POST with a one-shot body", New(), http.MethodPost, func() any { return io.MultiReader(strings.NewReader("payload")) }, 1},
+		{"POST without body", New(), http.MethodPost, nil, 1},
+		{"POST with idempotency key", New().EnableIdempotencyKeys(""), http.MethodPost, nil, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			accepted.Store(0)
+			client := tc.client.SetBaseURL("http://"+ln.Addr().String()).SetRetry(3, nil)
+			var params []any
+			if tc.body != nil {
+				params = append(params, tc.body())
+			}
+			_, err := client.Do(context.Background(), tc.method, "/", params...)
+			if err == nil {
+				t.Fatal("got no error from a server that closes every connection")
+			}
+			if got := accepted.Load(); got != tc.want {
+				t.Fatalf("got %d connections, want %d: %v", got, tc.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// compiledSchemas caches compiled schemas by their source, as the same few
+// schemas are usually checked over and over.
+var compiledSchemas sync.Map
+
+// ValidateJSONSchema checks the body against a JSON Schema given as a JSON
+// document, and returns a *SchemaError listing every violation. The body is
+// buffered, so it can still be read with ToJSON and friends afterwards.
+func (r *Resp) ValidateJSONSchema(schema string) error {
+	compiled, err := compileSchema(schema)
+	if err != nil {
+		return err
+	}
+
+	body, err := r.ReadAll()
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var instance any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&instance); err != nil {
+		return err
+	}
+	if err := compiled.Validate(instance); err != nil {
+		var validationErr *jsonschema.ValidationError
+		if !errors.As(err, &validationErr) {
+			return err
+		}
+		return &SchemaError{Violations: violations(validationErr, nil), err: err}
+	}
+	return nil
+}
+
+func compileSchema(schema string) (*jsonschema.Schema, error) {
+	if compiled, ok := compiledSchemas.Load(schema); ok {
+		return compiled.(*jsonschema.Schema), nil
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("schema.json", strings.NewReader(schema)); err != nil {
+		return nil, err
+	}
+	compiled, err := compiler.Compile("schema.json")
+	if err != nil {
+		return nil, err
+	}
+	compiledSchemas.Store(schema, compiled)
+	return compiled, nil
+}
+
+// violations collects the leaves of the error tree, which name the actual
+// failing values rather than the schema keywords that combine them.
+func violations(err *jsonschema.ValidationError, out []string) []string {
+	if len(err.Causes) == 0 {
+		location := err.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		return append(out, location+": "+err.Message)
+	}
+	for _, cause := range err.Causes {
+		out = violations(cause, out)
+	}
+	return out
+}
@@ -0,0 +1,71 @@
+package request
+
+import (
+	"context"
+	"sync"
+)
+
+// Shutdown makes every following Do fail with ErrClientClosed, waits for the
+// requests in flight to finish and then closes idle connections. A request
+// is in flight until its response body is closed. If ctx is done first,
+// Shutdown returns its error and leaves the remaining requests alone.
+func (r *Client) Shutdown(ctx context.Context) error {
+	r.mux.Lock()
+	r.closed = true
+	if r.stopCleanup != nil {
+		close(r.stopCleanup)
+		r.stopCleanup = nil
+	}
+	var drained chan struct{}
+	if r.inflight > 0 {
+		if r.drained == nil {
+			r.drained = make(chan struct{})
+		}
+		drained = r.drained
+	}
+	r.mux.Unlock()
+
+	if drained != nil {
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	r.CloseIdleConnections()
+	return nil
+}
+
+func (r *Client) enter() bool {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.closed {
+		return false
+	}
+	r.inflight++
+	return true
+}
+
+func (r *Client) leave() {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.inflight--
+	if r.inflight == 0 && r.drained != nil {
+		close(r.drained)
+		r.drained = nil
+	}
+}
+
+// releaseOnce runs releases in reverse order the first time it is called.
+func releaseOnce(releases []func()) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			for i := len(releases) - 1; i >= 0; i-- {
+				releases[i]()
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package request
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// EnableSingleFlight collapses concurrent GET and HEAD requests for the same
+// URL and headers into a single upstream call. The shared response body is buffered in
+// memory so every caller gets an independent copy, which costs one full body
+// per in-flight key; avoid it for endpoints serving large downloads. A caller
+// whose context ends stops waiting without cancelling the shared call.
+func (r *Client) EnableSingleFlight() *Client {
+	r.flight = &singleflight.Group{}
+	return r
+}
+
+type sharedResponse struct {
+	resp *http.Response
+	body []byte
+}
+
+func (r *Client) sendShared(req *http.Request) (*http.Response, error) {
+	ch := r.flight.DoChan(flightKey(req), func() (any, error) {
+		// The call is shared, so the caller that started it must not cancel
+		// it for the others by going away.
+		resp, err := r.sendWithRetry(req.WithContext(detachedContext{req.Context()}))
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &sharedResponse{resp: resp, body: body}, nil
+	})
+
+	var result singleflight.Result
+	select {
+	case result = <-ch:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	if result.Err != nil {
+		return nil, result.Err
+	}
+
+	shared := result.Val.(*sharedResponse)
+	resp := *shared.resp
+	resp.Header = shared.resp.Header.Clone()
+	resp.Body = io.NopCloser(bytes.NewReader(shared.body))
+	resp.Request = req
+	return &resp, nil
+}
+
+// flightKey only collapses requests that send the same headers, so callers
+// with different credentials or content negotiation never share a response.
+func flightKey(req *http.Request) string {
+	h := sha256.New()
+	_ = req.Header.Write(h)
+	return req.Method + " " + req.URL.String() + " " + hex.EncodeToString(h.Sum(nil))
+}
+
+// detachedContext keeps the values of its parent but not its deadline or
+// cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key any) any {
+	return c.parent.Value(key)
+}
@@ -0,0 +1,94 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSingleFlightKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer srv.Close()
+
+	client := New().SetBaseURL(srv.URL).EnableSingleFlight()
+
+	var wg sync.WaitGroup
+	for _, auth := range []string{"one", "two", "three"} {
+		wg.Add(1)
+		go func(auth string) {
+			defer wg.Done()
+			resp, err := client.Get(context.Background(), "/", Headers{"Authorization": auth})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if data, _ := resp.ReadAll(); string(data) != auth {
+				t.Errorf("got %q, want the response for %q", data, auth)
+			}
+		}(auth)
+	}
+	wg.Wait()
+}
+
+func TestSingleFlightLeaderContext(t *testing.T) {
+	var hits atomic.Int32
+	arrived, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			close(arrived)
+		}
+		<-release
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	client := New().SetBaseURL(srv.URL).EnableSingleFlight()
+
+	// The leader starts the shared call and gives up before it completes.
+	leaderDone := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := client.Get(ctx, "/")
+		leaderDone <- err
+	}()
+	<-arrived
+
+	type result struct {
+		data string
+		err  error
+	}
+	followerDone := make(chan result, 1)
+	go func() {
+		resp, err := client.Get(context.Background(), "/")
+		if err != nil {
+			followerDone <- result{err: err}
+			return
+		}
+		data, err := resp.ReadAll()
+		followerDone <- result{string(data), err}
+	}()
+
+	start := time.Now()
+	if err := <-leaderDone; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("leader got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("leader waited %v for the shared call", elapsed)
+	}
+	close(release)
+
+	if res := <-followerDone; res.err != nil || res.data != "ok" {
+		t.Fatalf("follower got %q, %v, want the shared response", res.data, res.err)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("server got %d requests, want 1 shared call", n)
+	}
+}
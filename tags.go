@@ -0,0 +1,59 @@
+package request
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+type tagsKey struct{}
+
+// WithTags attaches observability tags, such as an operation name or tenant
+// ID, to requests made with ctx. Tags are never sent over the wire: they are
+// appended to the client's log messages and are available to hooks through
+// TagsFromContext. Tags already on ctx are kept unless overridden.
+func WithTags(ctx context.Context, tags map[string]string) context.Context {
+	parent := TagsFromContext(ctx)
+	merged := make(map[string]string, len(parent)+len(tags))
+	for key, value := range parent {
+		merged[key] = value
+	}
+	for key, value := range tags {
+		merged[key] = value
+	}
+	return context.WithValue(ctx, tagsKey{}, merged)
+}
+
+// TagsFromContext returns the tags set by WithTags. The map must not be
+// modified.
+func TagsFromContext(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(tagsKey{}).(map[string]string)
+	return tags
+}
+
+// formatTags renders the tags on ctx as a log message suffix, e.g.
+// " [op=list tenant=42]", or "" when there are none.
+func formatTags(ctx context.Context) string {
+	tags := TagsFromContext(ctx)
+	if len(tags) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(" [")
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(tags[key])
+	}
+	b.WriteByte(']')
+	return b.String()
+}
@@ -0,0 +1,33 @@
+package request
+
+import (
+	"mime"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Text reads the whole body and decodes it to UTF-8 according to the charset
+// parameter of the Content-Type, e.g. "text/html; charset=GBK". The body is
+// returned as is when no charset is given.
+func (r *Resp) Text() (string, error) {
+	body, err := r.ReadAll()
+	if err != nil {
+		return "", err
+	}
+
+	_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	charset := strings.ToLower(strings.TrimSpace(params["charset"]))
+	if charset == "" || charset == "utf-8" || charset == "utf8" {
+		return string(body), nil
+	}
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return "", err
+	}
+	decoded, err := encoding.NewDecoder().Bytes(body)
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
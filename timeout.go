@@ -0,0 +1,138 @@
+package request
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// SetResponseBodyTimeout fails a read of the response body that waits more
+// than idle for data, closing the body. Unlike SetTimeout it doesn't bound
+// the total time, so long streams keep working as long as bytes keep coming.
+// Time spent by the caller between reads doesn't count.
+func (r *Client) SetResponseBodyTimeout(idle time.Duration) *Client {
+	r.bodyIdleTimeout = idle
+	return r
+}
+
+// SetRequestTimeout bounds the time Do waits for the response headers,
+// retries included. Once they arrive the timer stops, so reading the body is
+// not limited by it.
+func (r *Client) SetRequestTimeout(d time.Duration) *Client {
+	r.requestTimeout = d
+	return r
+}
+
+func (r *Client) requestTimeoutErr() error {
+	return fmt.Errorf("no response headers within %s: %w", r.requestTimeout, os.ErrDeadlineExceeded)
+}
+
+type idleTimeoutBody struct {
+	body     io.ReadCloser
+	idle     time.Duration
+	timer    *time.Timer
+	timedOut atomic.Bool
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, idle time.Duration) *idleTimeoutBody {
+	b := &idleTimeoutBody{body: body, idle: idle}
+	b.timer = time.AfterFunc(idle, func() {
+		b.timedOut.Store(true)
+		_ = b.body.Close()
+	})
+	b.timer.Stop()
+	return b
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	if b.timedOut.Load() {
+		return 0, b.timeoutErr()
+	}
+	b.timer.Reset(b.idle)
+	n, err := b.body.Read(p)
+	b.timer.Stop()
+	if b.timedOut.Load() {
+		return n, b.timeoutErr()
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	return b.body.Close()
+}
+
+// timeoutErr wraps os.ErrDeadlineExceeded, so it reports Timeout() like
+// other network timeouts.
+func (b *idleTimeoutBody) timeoutErr() error {
+	return fmt.Errorf("response body idle for %s: %w", b.idle, os.ErrDeadlineExceeded)
+}
+
+// SetDownloadLimits fails reading a response body once more than maxBytes
+// have been read, counted after decompression, or once maxDuration has passed
+// since the headers arrived, with ErrBodyTooLarge or ErrBodyTimeout. The body
+// is closed, so the connection isn't reused. Zero disables a limit.
+func (r *Client) SetDownloadLimits(maxBytes int64, maxDuration time.Duration) *Client {
+	r.maxBodyBytes = maxBytes
+	r.maxBodyDuration = maxDuration
+	return r
+}
+
+type limitedBody struct {
+	body      io.ReadCloser
+	remaining int64
+	maxBytes  int64
+	timer     *time.Timer
+	timedOut  atomic.Bool
+	err       error
+}
+
+func newLimitedBody(body io.ReadCloser, maxBytes int64, maxDuration time.Duration) *limitedBody {
+	b := &limitedBody{body: body, remaining: maxBytes, maxBytes: maxBytes}
+	if maxDuration > 0 {
+		b.timer = time.AfterFunc(maxDuration, func() {
+			b.timedOut.Store(true)
+			_ = b.body.Close()
+		})
+	}
+	return b
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.timedOut.Load() {
+		b.err = ErrBodyTimeout
+		return 0, b.err
+	}
+	// Read one byte past the limit to tell a body that ends right at it from
+	// one that goes on.
+	if b.maxBytes > 0 && int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.body.Read(p)
+	if b.timedOut.Load() {
+		b.err = ErrBodyTimeout
+		return n, b.err
+	}
+	if b.maxBytes > 0 {
+		if int64(n) > b.remaining {
+			n = int(b.remaining)
+			b.err = fmt.Errorf("%w: over %d bytes", ErrBodyTooLarge, b.maxBytes)
+			_ = b.Close()
+			return n, b.err
+		}
+		b.remaining -= int64(n)
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	return b.body.Close()
+}
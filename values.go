@@ -0,0 +1,202 @@
+package request
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type bodyForm struct {
+	v any
+}
+
+// BodyForm encodes a struct as an application/x-www-form-urlencoded body
+// using `form:"name,omitempty"` field tags.
+func BodyForm(v any) *bodyForm {
+	return &bodyForm{v: v}
+}
+
+type queryStruct struct {
+	v any
+}
+
+// QueryStruct encodes a struct into the request query using
+// `url:"name,omitempty"` field tags. The values are appended to the query
+// already present in the URI, and an explicit Query param overrides them.
+func QueryStruct(v any) *queryStruct {
+	return &queryStruct{v: v}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// encodeValues flattens a struct (or a map with string keys) into url.Values.
+// Slices produce repeated keys, nested structs are encoded as parent[child]
+// and time.Time values use RFC 3339 unless the tag carries the unix option.
+func encodeValues(v any, tagName string) (url.Values, error) {
+	values := make(url.Values)
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return values, nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return values, nil
+	}
+	if err := encodeValue(values, "", rv, tagName, tagOptions{}); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+type tagOptions struct {
+	omitempty bool
+	unix      bool
+}
+
+func parseTag(tag string) (string, tagOptions) {
+	name, rest, _ := strings.Cut(tag, ",")
+	var opts tagOptions
+	for _, opt := range strings.Split(rest, ",") {
+		switch opt {
+		case "omitempty":
+			opts.omitempty = true
+		case "unix":
+			opts.unix = true
+		}
+	}
+	return name, opts
+}
+
+func encodeValue(values url.Values, key string, rv reflect.Value, tagName string, opts tagOptions) error {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			if !opts.omitempty && key != "" {
+				values.Add(key, "")
+			}
+			return nil
+		}
+		rv = rv.Elem()
+	}
+
+	if opts.omitempty && rv.IsZero() {
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+		if rv.Type() == timeType {
+			t := rv.Interface().(time.Time)
+			if opts.unix {
+				values.Add(key, strconv.FormatInt(t.Unix(), 10))
+			} else {
+				values.Add(key, t.Format(time.RFC3339))
+			}
+			return nil
+		}
+		return encodeStruct(values, key, rv, tagName)
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported map key type %s", rv.Type().Key())
+		}
+		iter := rv.MapRange()
+		for iter.Next() {
+			if err := encodeValue(values, joinKey(key, iter.Key().String()), iter.Value(), tagName, tagOptions{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			values.Add(key, string(rv.Bytes()))
+			return nil
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := encodeValue(values, key, rv.Index(i), tagName, tagOptions{unix: opts.unix}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if key == "" {
+		return fmt.Errorf("unsupported value type %s", rv.Type())
+	}
+	value, err := formatScalar(rv)
+	if err != nil {
+		return err
+	}
+	values.Add(key, value)
+	return nil
+}
+
+func encodeStruct(values url.Values, prefix string, rv reflect.Value, tagName string) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get(tagName)
+		if tag == "-" {
+			continue
+		}
+		name, opts := parseTag(tag)
+
+		fv := rv.Field(i)
+		if field.Anonymous && name == "" {
+			for fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					break
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+				if err := encodeStruct(values, prefix, fv, tagName); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		if err := encodeValue(values, joinKey(prefix, name), fv, tagName, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func joinKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "[" + name + "]"
+}
+
+func formatScalar(rv reflect.Value) (string, error) {
+	if stringer, ok := rv.Interface().(fmt.Stringer); ok {
+		return stringer.String(), nil
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("unsupported value type %s", rv.Type())
+}
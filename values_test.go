@@ -0,0 +1,25 @@
+package request
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestNilValueParams(t *testing.T) {
+	params := map[string]any{
+		"BodyForm":    BodyForm(nil),
+		"QueryStruct": QueryStruct(nil),
+	}
+	for name, param := range params {
+		t.Run(name, func(t *testing.T) {
+			req, err := New().BuildRequest(context.Background(), http.MethodPost, "http://api.test/?a=1", param)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if req.URL.RawQuery != "a=1" {
+				t.Fatalf("got query %q", req.URL.RawQuery)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package request
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"time"
+)
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC11B65"
+
+// Dial performs a WebSocket opening handshake through the regular request
+// pipeline, so base URLs, base headers, proxies, TLS settings and balancers
+// all apply. On success it returns the upgraded connection; framing is left
+// to the caller. ws:// and wss:// URIs are mapped to http:// and https://.
+// The handshake response is returned as well, also when the server refuses
+// the upgrade.
+func (r *Client) Dial(ctx context.Context, uri string, headers Headers) (net.Conn, *Resp, error) {
+	if strings.HasPrefix(uri, "ws://") {
+		uri = "http://" + strings.TrimPrefix(uri, "ws://")
+	} else if strings.HasPrefix(uri, "wss://") {
+		uri = "https://" + strings.TrimPrefix(uri, "wss://")
+	}
+
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	handshake := Headers{}
+	for k, v := range headers {
+		handshake[k] = v
+	}
+	handshake["Connection"] = "Upgrade"
+	handshake["Upgrade"] = "websocket"
+	handshake["Sec-WebSocket-Version"] = "13"
+	handshake["Sec-WebSocket-Key"] = key
+
+	var conn net.Conn
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			conn = info.Conn
+		},
+	})
+
+	resp, err := r.Do(ctx, http.MethodGet, uri, handshake)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, resp, fmt.Errorf("websocket handshake failed with status %s", resp.Status)
+	}
+
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		_ = resp.Body.Close()
+		return nil, resp, errors.New("websocket handshake response body is not writable")
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		_ = rwc.Close()
+		return nil, resp, fmt.Errorf("unexpected upgrade protocol %q", resp.Header.Get("Upgrade"))
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		_ = rwc.Close()
+		return nil, resp, errors.New("invalid Sec-WebSocket-Accept header")
+	}
+	return &upgradedConn{ReadWriteCloser: rwc, conn: conn}, resp, nil
+}
+
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func isUpgradeRequest(req *http.Request) bool {
+	return req.Header.Get("Upgrade") != ""
+}
+
+// clientFor drops the overall timeout of an *http.Client for upgrade
+// requests: http.Client wraps the response body to enforce it, which hides
+// the writable connection of a 101 response. The handshake is still bounded
+// by the request context.
+func clientFor(req *http.Request, client HTTPClient) HTTPClient {
+	if httpClient, ok := client.(*http.Client); ok && httpClient.Timeout > 0 && isUpgradeRequest(req) {
+		upgradeClient := *httpClient
+		upgradeClient.Timeout = 0
+		return &upgradeClient
+	}
+	return client
+}
+
+// upgradedConn reads and writes through the response body, which still holds
+// any bytes the transport buffered past the handshake, and takes addresses
+// and deadlines from the underlying connection.
+type upgradedConn struct {
+	io.ReadWriteCloser
+	conn net.Conn
+}
+
+func (c *upgradedConn) LocalAddr() net.Addr {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.LocalAddr()
+}
+
+func (c *upgradedConn) RemoteAddr() net.Addr {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.RemoteAddr()
+}
+
+func (c *upgradedConn) SetDeadline(t time.Time) error {
+	if c.conn == nil {
+		return errors.New("deadlines are not supported on this connection")
+	}
+	return c.conn.SetDeadline(t)
+}
+
+func (c *upgradedConn) SetReadDeadline(t time.Time) error {
+	if c.conn == nil {
+		return errors.New("deadlines are not supported on this connection")
+	}
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *upgradedConn) SetWriteDeadline(t time.Time) error {
+	if c.conn == nil {
+		return errors.New("deadlines are not supported on this connection")
+	}
+	return c.conn.SetWriteDeadline(t)
+}